@@ -0,0 +1,130 @@
+package noaalert
+
+import (
+	"errors"
+	"fmt"
+
+	api "github.com/rotationalio/go-ensign/api/v1beta1"
+	"github.com/rs/zerolog/log"
+)
+
+// NackReason describes why a subscriber could not handle an alert; each reason maps to
+// an Ensign nack code that determines whether and where the alert is redelivered.
+type NackReason uint8
+
+const (
+	NackUnprocessed        NackReason = iota // The alert could not be handled and should not be redelivered
+	NackTimeout                              // Handling the alert took too long
+	NackUnknownType                          // The subscriber does not handle this type of event
+	NackUnhandledMimetype                    // The subscriber cannot decode the event data
+	NackRedeliver                            // The alert should be redelivered to any subscriber
+	NackRedeliverElsewhere                   // The alert should be redelivered to a different subscriber
+)
+
+// Code returns the Ensign nack code for the reason.
+func (r NackReason) Code() api.Nack_Code {
+	switch r {
+	case NackTimeout:
+		return api.Nack_TIMEOUT
+	case NackUnknownType:
+		return api.Nack_UNKNOWN_TYPE
+	case NackUnhandledMimetype:
+		return api.Nack_UNHANDLED_MIMETYPE
+	case NackRedeliver:
+		return api.Nack_DELIVER_AGAIN_ANY
+	case NackRedeliverElsewhere:
+		return api.Nack_DELIVER_AGAIN_NOT_ME
+	default:
+		return api.Nack_UNPROCESSED
+	}
+}
+
+func (r NackReason) String() string {
+	switch r {
+	case NackUnprocessed:
+		return "unprocessed"
+	case NackTimeout:
+		return "timeout"
+	case NackUnknownType:
+		return "unknown_type"
+	case NackUnhandledMimetype:
+		return "unhandled_mimetype"
+	case NackRedeliver:
+		return "redeliver"
+	case NackRedeliverElsewhere:
+		return "redeliver_elsewhere"
+	default:
+		return "unknown"
+	}
+}
+
+// Ack tells Ensign that the alert was handled so that it is not redelivered. When the
+// subscriber is not configured for manual acks, alerts are acked when they are received
+// and calling Ack has no effect. Acking an alert that was nacked has no effect.
+func (a *AlertEvent) Ack() (err error) {
+	if a.event == nil {
+		return ErrNotSubscribed
+	}
+
+	if _, err = a.event.Ack(); err != nil {
+		return fmt.Errorf("could not ack alert: %w", err)
+	}
+	return nil
+}
+
+// Nack tells Ensign that the alert could not be handled for the specified reason.
+// Nacking an alert that was acked has no effect.
+func (a *AlertEvent) Nack(reason NackReason) (err error) {
+	if a.event == nil {
+		return ErrNotSubscribed
+	}
+
+	if _, err = a.event.Nack(reason.Code()); err != nil {
+		return fmt.Errorf("could not nack alert: %w", err)
+	}
+	return nil
+}
+
+// Redeliver nacks the alert so that Ensign delivers it again, e.g. if handling the alert
+// failed because of a temporary outage.
+func (a *AlertEvent) Redeliver() error {
+	return a.Nack(NackRedeliver)
+}
+
+// Returns true if the alert was received from a subscription and has been acked or
+// nacked by the subscriber.
+func (a *AlertEvent) settled() bool {
+	if a.event == nil {
+		return false
+	}
+
+	acked, _ := a.event.Acked()
+	nacked, _ := a.event.Nacked()
+	return acked || nacked
+}
+
+// Settle an alert that the callback did not ack or nack using the result of the
+// callback: alerts are acked if the callback succeeded, nacked if it timed out, and
+// redelivered if it failed so that every alert is handled at least once.
+func (a *AlertEvent) settle(err error) {
+	if a.settled() {
+		return
+	}
+
+	var reason NackReason
+	switch {
+	case err == nil:
+		if err := a.Ack(); err != nil {
+			log.Warn().Err(err).Msg("could not ack alert after callback")
+		}
+		return
+	case errors.Is(err, ErrCallbackTimeout):
+		reason = NackTimeout
+	default:
+		reason = NackRedeliver
+	}
+
+	if err := a.Nack(reason); err != nil {
+		log.Warn().Err(err).Str("reason", reason.String()).Msg("could not nack alert after callback")
+	}
+}
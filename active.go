@@ -0,0 +1,316 @@
+package noaalert
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ExpiryInterval is how often ActiveAlerts.Feed removes alerts that have ended.
+const ExpiryInterval = time.Minute
+
+// ActiveAlerts maintains the set of currently active alerts from the events received
+// by a Subscriber, indexed by alert ID, zone (UGC), SAME/FIPS code, event, and severity.
+// Updates replace the alerts they supersede and alerts are removed when they are
+// cancelled, expire, or end. It is safe for concurrent use; alerts returned by queries
+// are shared and must not be modified.
+type ActiveAlerts struct {
+	mu         sync.RWMutex
+	alerts     map[string]*Alert
+	zones      index
+	same       index
+	events     index
+	severities index
+	watchers   map[chan AlertChange]struct{}
+}
+
+// ChangeType describes how the set of active alerts changed.
+type ChangeType uint8
+
+const (
+	AlertAdded ChangeType = iota + 1
+	AlertReplaced
+	AlertRemoved
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case AlertAdded:
+		return "added"
+	case AlertReplaced:
+		return "replaced"
+	case AlertRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// AlertChange is sent to watchers when an alert is added, replaced by an update, or
+// removed from the active alerts. Previous contains the IDs of replaced alerts.
+type AlertChange struct {
+	Type     ChangeType
+	Alert    *Alert
+	Previous []string
+}
+
+// A secondary index from a key to the set of alert IDs with that key.
+type index map[string]map[string]struct{}
+
+func (i index) add(key, id string) {
+	if _, ok := i[key]; !ok {
+		i[key] = make(map[string]struct{})
+	}
+	i[key][id] = struct{}{}
+}
+
+func (i index) remove(key, id string) {
+	if ids, ok := i[key]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(i, key)
+		}
+	}
+}
+
+func NewActiveAlerts() *ActiveAlerts {
+	return &ActiveAlerts{
+		alerts:     make(map[string]*Alert),
+		zones:      make(index),
+		same:       make(index),
+		events:     make(index),
+		severities: make(index),
+		watchers:   make(map[chan AlertChange]struct{}),
+	}
+}
+
+// Feed applies the events from a subscription until the channel is closed, removing
+// alerts that have ended every ExpiryInterval.
+func (a *ActiveAlerts) Feed(alerts <-chan *AlertEvent) {
+	ticker := time.NewTicker(ExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-alerts:
+			if !ok {
+				return
+			}
+
+			if err := a.Apply(event); err != nil {
+				log.Debug().Err(err).Msg("could not apply alert event to active alerts")
+			}
+		case now := <-ticker.C:
+			a.Expire(now)
+		}
+	}
+}
+
+// Apply updates the active alerts from an alert event. Cancellations and expirations
+// remove the referenced alerts, updates replace the alerts they supersede, and all
+// other alerts are added unless they have already ended.
+func (a *ActiveAlerts) Apply(event *AlertEvent) (err error) {
+	var alert *Alert
+	if alert, err = event.Alert(); err != nil {
+		return err
+	}
+
+	if alert.ID == "" {
+		return ErrNoAlertID
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case event.EventType() == AlertExpiredType:
+		a.remove(alert.ID)
+	case event.EventType() == AlertCancelledType || alert.MessageType == MessageTypeCancel:
+		for _, id := range event.Supersedes() {
+			a.remove(id)
+		}
+	default:
+		if !alert.End().IsZero() && !alert.End().After(time.Now()) {
+			return nil
+		}
+
+		previous := make([]string, 0)
+		for _, id := range event.Supersedes() {
+			if a.drop(id) != nil {
+				previous = append(previous, id)
+			}
+		}
+
+		// A redelivered alert replaces itself.
+		if a.drop(alert.ID) != nil {
+			previous = append(previous, alert.ID)
+		}
+
+		a.insert(alert)
+		if len(previous) > 0 {
+			a.notify(AlertChange{Type: AlertReplaced, Alert: alert, Previous: previous})
+		} else {
+			a.notify(AlertChange{Type: AlertAdded, Alert: alert})
+		}
+	}
+	return nil
+}
+
+// Expire removes the alerts that ended before the specified time and returns the
+// number of alerts that were removed.
+func (a *ActiveAlerts) Expire(now time.Time) (n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for id, alert := range a.alerts {
+		if end := alert.End(); !end.IsZero() && !end.After(now) {
+			a.remove(id)
+			n++
+		}
+	}
+	return n
+}
+
+// Get returns the active alert with the specified ID.
+func (a *ActiveAlerts) Get(id string) (*Alert, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	alert, ok := a.alerts[id]
+	return alert, ok
+}
+
+// Len returns the number of active alerts.
+func (a *ActiveAlerts) Len() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.alerts)
+}
+
+// Snapshot returns all active alerts ordered by the time they were sent.
+func (a *ActiveAlerts) Snapshot() []*Alert {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	alerts := make([]*Alert, 0, len(a.alerts))
+	for _, alert := range a.alerts {
+		alerts = append(alerts, alert)
+	}
+	return sortAlerts(alerts)
+}
+
+// Zone returns the active alerts that affect the zone with the specified UGC code.
+func (a *ActiveAlerts) Zone(ugc string) []*Alert {
+	return a.lookup(a.zones, strings.ToUpper(ugc))
+}
+
+// SAME returns the active alerts that affect the area with the specified SAME code.
+func (a *ActiveAlerts) SAME(code string) []*Alert {
+	return a.lookup(a.same, code)
+}
+
+// Event returns the active alerts with the specified event name, e.g. "Flood Warning".
+func (a *ActiveAlerts) Event(name string) []*Alert {
+	return a.lookup(a.events, strings.ToLower(name))
+}
+
+// Severity returns the active alerts with the specified severity.
+func (a *ActiveAlerts) Severity(severity Severity) []*Alert {
+	return a.lookup(a.severities, strings.ToLower(string(severity)))
+}
+
+// Watch returns a channel of changes to the active alerts and a function to stop
+// watching that closes the channel. Changes are dropped if the channel buffer is full
+// so that slow watchers do not block the subscription.
+func (a *ActiveAlerts) Watch(buffer int) (<-chan AlertChange, func()) {
+	changes := make(chan AlertChange, buffer)
+
+	a.mu.Lock()
+	a.watchers[changes] = struct{}{}
+	a.mu.Unlock()
+
+	var once sync.Once
+	return changes, func() {
+		once.Do(func() {
+			a.mu.Lock()
+			delete(a.watchers, changes)
+			close(changes)
+			a.mu.Unlock()
+		})
+	}
+}
+
+func (a *ActiveAlerts) lookup(idx index, key string) []*Alert {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	alerts := make([]*Alert, 0, len(idx[key]))
+	for id := range idx[key] {
+		alerts = append(alerts, a.alerts[id])
+	}
+	return sortAlerts(alerts)
+}
+
+// Must be called with the write lock held.
+func (a *ActiveAlerts) insert(alert *Alert) {
+	a.alerts[alert.ID] = alert
+	for _, ugc := range alert.Geocode.UGC {
+		a.zones.add(strings.ToUpper(ugc), alert.ID)
+	}
+
+	for _, code := range alert.Geocode.SAME {
+		a.same.add(code, alert.ID)
+	}
+
+	a.events.add(strings.ToLower(alert.Event), alert.ID)
+	a.severities.add(strings.ToLower(string(alert.Severity)), alert.ID)
+}
+
+// Removes the alert from the indices without notifying watchers. Must be called with
+// the write lock held.
+func (a *ActiveAlerts) drop(id string) *Alert {
+	alert, ok := a.alerts[id]
+	if !ok {
+		return nil
+	}
+
+	delete(a.alerts, id)
+	for _, ugc := range alert.Geocode.UGC {
+		a.zones.remove(strings.ToUpper(ugc), id)
+	}
+
+	for _, code := range alert.Geocode.SAME {
+		a.same.remove(code, id)
+	}
+
+	a.events.remove(strings.ToLower(alert.Event), id)
+	a.severities.remove(strings.ToLower(string(alert.Severity)), id)
+	return alert
+}
+
+// Must be called with the write lock held.
+func (a *ActiveAlerts) remove(id string) {
+	if alert := a.drop(id); alert != nil {
+		a.notify(AlertChange{Type: AlertRemoved, Alert: alert})
+	}
+}
+
+// Must be called with the write lock held.
+func (a *ActiveAlerts) notify(change AlertChange) {
+	for watcher := range a.watchers {
+		select {
+		case watcher <- change:
+		default:
+			log.Debug().Str("alert_id", change.Alert.ID).Str("change", change.Type.String()).Msg("dropped active alert change for slow watcher")
+		}
+	}
+}
+
+func sortAlerts(alerts []*Alert) []*Alert {
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Sent.Before(alerts[j].Sent)
+	})
+	return alerts
+}
@@ -0,0 +1,90 @@
+package noaalert_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveAlerts(t *testing.T) {
+	active := noaalert.NewActiveAlerts()
+	changes, stop := active.Watch(10)
+	defer stop()
+
+	now := time.Now().Truncate(time.Second)
+	flood := &noaalert.Alert{
+		ID:          "alert-1",
+		Sent:        now.Add(-time.Hour),
+		Expires:     now.Add(time.Hour),
+		Event:       "Flood Warning",
+		Severity:    noaalert.SeverityModerate,
+		MessageType: noaalert.MessageTypeAlert,
+		Geocode:     noaalert.Geocode{UGC: []string{"MAZ005", "MAZ006"}, SAME: []string{"025009"}},
+	}
+	heat := &noaalert.Alert{
+		ID:          "alert-2",
+		Sent:        now.Add(-30 * time.Minute),
+		Expires:     now.Add(10 * time.Minute),
+		Event:       "Heat Advisory",
+		Severity:    noaalert.SeverityMinor,
+		MessageType: noaalert.MessageTypeAlert,
+		Geocode:     noaalert.Geocode{UGC: []string{"MAZ006"}, SAME: []string{"025017"}},
+	}
+
+	require.NoError(t, active.Apply(alertEvent(t, flood)))
+	require.NoError(t, active.Apply(alertEvent(t, heat)))
+	require.Equal(t, 2, active.Len())
+	require.Len(t, active.Zone("maz006"), 2)
+	require.Len(t, active.SAME("025009"), 1)
+	require.Len(t, active.Event("flood warning"), 1)
+	require.Len(t, active.Severity(noaalert.SeverityMinor), 1)
+	require.Equal(t, "alert-1", active.Snapshot()[0].ID)
+	require.Equal(t, noaalert.AlertAdded, (<-changes).Type)
+	require.Equal(t, noaalert.AlertAdded, (<-changes).Type)
+
+	// An update replaces the alert it references and is reindexed
+	update := *flood
+	update.ID, update.Sent = "alert-3", now
+	update.MessageType = noaalert.MessageTypeUpdate
+	update.Severity = noaalert.SeveritySevere
+	update.References = []noaalert.Reference{{Identifier: "alert-1"}}
+	require.NoError(t, active.Apply(alertEvent(t, &update)))
+	require.Equal(t, 2, active.Len())
+	require.Empty(t, active.Severity(noaalert.SeverityModerate))
+	require.Len(t, active.Severity(noaalert.SeveritySevere), 1)
+
+	change := <-changes
+	require.Equal(t, noaalert.AlertReplaced, change.Type)
+	require.Equal(t, []string{"alert-1"}, change.Previous)
+
+	// A cancellation removes the alerts it references
+	cancel := update
+	cancel.ID, cancel.MessageType = "alert-4", noaalert.MessageTypeCancel
+	cancel.References = []noaalert.Reference{{Identifier: "alert-1"}, {Identifier: "alert-3"}}
+	require.NoError(t, active.Apply(alertEvent(t, &cancel)))
+	require.Equal(t, 1, active.Len())
+	require.Empty(t, active.Zone("MAZ005"))
+	require.Equal(t, noaalert.AlertRemoved, (<-changes).Type)
+
+	// Alerts are removed when they end
+	require.Equal(t, 0, active.Expire(now))
+	require.Equal(t, 1, active.Expire(now.Add(time.Hour)))
+	require.Equal(t, 0, active.Len())
+
+	// Expired events remove the alert
+	require.NoError(t, active.Apply(alertEvent(t, heat)))
+	expired := alertEvent(t, heat)
+	expired.Type = noaalert.AlertExpiredType
+	require.NoError(t, active.Apply(expired))
+	_, ok := active.Get("alert-2")
+	require.False(t, ok)
+}
+
+func alertEvent(t *testing.T, alert *noaalert.Alert) *noaalert.AlertEvent {
+	data, err := json.Marshal(alert)
+	require.NoError(t, err)
+	return &noaalert.AlertEvent{Data: data}
+}
@@ -1,8 +1,12 @@
 package noaalert
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 
 	sdk "github.com/rotationalio/go-ensign"
 	api "github.com/rotationalio/go-ensign/api/v1beta1"
@@ -10,12 +14,17 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// Subscriber listens for alert events on the configured Ensign topic.
 type Subscriber struct {
 	ensign *sdk.Client
 	conf   Config
+	mu     sync.RWMutex
+	err    error
 }
 
-func NewAlerts(conf Config) (sub *Subscriber, err error) {
+// NewAlerts creates a Subscriber connected to Ensign. Any options are applied after the
+// options from the Ensign configuration, e.g. to connect to a mock Ensign server.
+func NewAlerts(conf Config, opts ...sdk.Option) (sub *Subscriber, err error) {
 	if conf.IsZero() {
 		if conf, err = NewConfig(); err != nil {
 			return nil, err
@@ -30,7 +39,7 @@ func NewAlerts(conf Config) (sub *Subscriber, err error) {
 		conf: conf,
 	}
 
-	if sub.ensign, err = sdk.New(conf.Ensign.Options()...); err != nil {
+	if sub.ensign, err = sdk.New(append(conf.Ensign.Options(), opts...)...); err != nil {
 		return nil, err
 	}
 
@@ -44,39 +53,53 @@ func NewAlerts(conf Config) (sub *Subscriber, err error) {
 	return sub, nil
 }
 
-func (s *Subscriber) Run(cb func(*AlertEvent) error) (err error) {
+// Run calls the callback with each alert until the process is interrupted or terminated.
+// Callbacks are run by the workers configured by the SubscriberConfig; the first callback
+// error stops the subscription and is returned unless the subscriber is configured to
+// continue on errors, in which case callback errors are logged. If a dead-letter topic
+// is configured, failed callbacks are retried and then the alert is dead-lettered. An
+// error from the subscription is returned; a graceful shutdown returns nil. Use Chain to
+// wrap the callback with middleware such as Recover, Filter, or Dedupe.
+func (s *Subscriber) Run(cb Handler) (err error) {
 	// Catch OS signals for graceful shutdowns
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var alerts <-chan *AlertEvent
-	done := make(chan struct{})
-	if alerts, err = s.Listen(done); err != nil {
+	if alerts, err = s.Listen(ctx); err != nil {
 		return err
 	}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	go func() {
-		<-quit
-		done <- struct{}{}
-	}()
-
-	for alert := range alerts {
-		if err = cb(alert); err != nil {
-			done <- struct{}{}
-			return err
-		}
+	workers := newWorkers(s.conf.Subscriber, cb, cancel)
+	if s.conf.DeadLetter.Topic != "" {
+		workers.deadLetter = s.deadLetter
+		workers.maxAttempts = s.conf.DeadLetter.MaxAttempts
+		workers.backoff = s.conf.DeadLetter.Backoff
+	}
+
+	if err = workers.run(ctx, alerts); err != nil {
+		return err
 	}
-	return nil
+	return s.Err()
 }
 
-func (s *Subscriber) Listen(done <-chan struct{}) (_ <-chan *AlertEvent, err error) {
+// Listen subscribes to the alerts topic and returns a channel of alerts. The channel is
+// closed when the context is cancelled or when the subscription fails; after the
+// channel is closed, Err returns the error that caused the subscription to fail.
+func (s *Subscriber) Listen(ctx context.Context) (_ <-chan *AlertEvent, err error) {
 	var sub *sdk.Subscription
 	if sub, err = s.ensign.Subscribe(s.conf.Topic); err != nil {
 		return nil, err
 	}
 
+	s.setErr(nil)
 	alerts := make(chan *AlertEvent, 100)
 	go func(alerts chan<- *AlertEvent, sub *sdk.Subscription) {
 		log.Info().Str("topic", s.conf.Topic).Msg("listening for alerts")
+		defer close(alerts)
 		defer sub.Close()
 
 		var (
@@ -84,56 +107,70 @@ func (s *Subscriber) Listen(done <-chan struct{}) (_ <-chan *AlertEvent, err err
 			skipped uint64
 		)
 
+		defer func() {
+			log.Info().Uint64("events", events).Uint64("skipped", skipped).Msg("closing subscription channel")
+		}()
+
 	eventLoop:
 		for {
 			select {
-			case event := <-sub.C:
+			case event, ok := <-sub.C:
+				if !ok {
+					s.setErr(ErrSubscriptionClosed)
+					return
+				}
+
 				log.Debug().Str("id", event.ID()).Str("topic_id", event.TopicID()).Str("type", event.Type.String()).Msg("event recv")
 
-				if event.Type.Name != "Alert" {
-					log.Debug().Str("type", event.Type.String()).Msg("unknown type")
-					if _, err := event.Nack(api.Nack_UNKNOWN_TYPE); err != nil {
-						log.Warn().Err(err).Str("id", event.ID()).Str("reason", "unknown_type").Msg("could not nack event")
+				if !isAlertType(event.Type) {
+					if err := s.reject(event, api.Nack_UNKNOWN_TYPE, DeadLetterUnknownType, fmt.Errorf("unknown event type %s", event.Type)); err != nil {
+						s.setErr(err)
+						return
 					}
 					skipped++
 					continue eventLoop
 				}
 
 				if event.Mimetype != Mimetype {
-					log.Debug().Str("mimetype", event.Mimetype.MimeType()).Msg("unknown mimetype")
-					if _, err := event.Nack(api.Nack_UNHANDLED_MIMETYPE); err != nil {
-						log.Warn().Err(err).Str("id", event.ID()).Str("reason", "unknown_mimetype").Msg("could not nack event")
+					if err := s.reject(event, api.Nack_UNHANDLED_MIMETYPE, DeadLetterUnhandledMimetype, fmt.Errorf("unhandled mimetype %s", event.Mimetype.MimeType())); err != nil {
+						s.setErr(err)
+						return
 					}
 					skipped++
 					continue eventLoop
 				}
 
-				alert := &AlertEvent{
-					CorrelationID: event.Metadata["correlation_id"],
-					RequestID:     event.Metadata["request_id"],
-					ServerID:      event.Metadata["server_id"],
-					LastModified:  event.Metadata["last_modified"],
-					Expires:       event.Metadata["expires"],
-					Data:          event.Data,
-				}
+				alert := newAlertEvent(event)
 
 				if err := alert.parse(); err != nil {
-					log.Debug().Err(err).Msg("could not parse alert")
-					if _, err := event.Nack(api.Nack_UNPROCESSED); err != nil {
-						log.Warn().Err(err).Str("id", event.ID()).Str("reason", "unprocessed").Msg("could not nack event")
+					if err := s.reject(event, api.Nack_UNPROCESSED, DeadLetterUnparseable, err); err != nil {
+						s.setErr(err)
+						return
 					}
 					skipped++
 					continue eventLoop
 				}
 
-				if _, err := event.Ack(); err != nil {
-					log.Warn().Err(err).Str("id", event.ID()).Msg("could not ack event")
+				// Acks and nacks are sent on the subscribe stream, so if they cannot be
+				// sent the subscription has failed. With manual acks the alert is acked
+				// or nacked after it is handled.
+				if !s.conf.Subscriber.ManualAck {
+					if _, err := event.Ack(); err != nil {
+						s.setErr(fmt.Errorf("could not ack event: %w", err))
+						return
+					}
 				}
 
-				alerts <- alert
-				events++
-			case <-done:
-				log.Info().Uint64("events", events).Uint64("skipped", events).Msg("closing subscription channel")
+				select {
+				case alerts <- alert:
+					events++
+				case <-ctx.Done():
+					if s.conf.Subscriber.ManualAck {
+						alert.Redeliver()
+					}
+					return
+				}
+			case <-ctx.Done():
 				return
 			}
 		}
@@ -142,3 +179,25 @@ func (s *Subscriber) Listen(done <-chan struct{}) (_ <-chan *AlertEvent, err err
 
 	return alerts, nil
 }
+
+// Close the connection to Ensign, including the stream used to publish dead letters.
+func (s *Subscriber) Close() error {
+	return s.ensign.Close()
+}
+
+// Err returns the error that caused the most recent subscription to fail, or nil if
+// the subscription is open or was closed by cancelling its context.
+func (s *Subscriber) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+func (s *Subscriber) setErr(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	if err != nil {
+		log.Warn().Err(err).Str("topic", s.conf.Topic).Msg("alerts subscription failed")
+	}
+}
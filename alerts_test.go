@@ -0,0 +1,298 @@
+package noaalert_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/oklog/ulid/v2"
+	sdk "github.com/rotationalio/go-ensign"
+	api "github.com/rotationalio/go-ensign/api/v1beta1"
+	ensignmock "github.com/rotationalio/go-ensign/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// A subscriber connected to a mock Ensign server. Events are sent to the subscription
+// using the handler, acks and nacks from the subscriber are sent to the replies channel,
+// and events published to the mock are sent to the published channel.
+type ensignTest struct {
+	srv       *ensignmock.Ensign
+	sub       *noaalert.Subscriber
+	handler   *ensignmock.SubscribeHandler
+	replies   chan string
+	published chan *api.Event
+}
+
+func ensignSubscriber(t *testing.T, conf noaalert.Config) *ensignTest {
+	e := &ensignTest{
+		srv:       ensignmock.New(nil),
+		handler:   ensignmock.NewSubscribeHandler(),
+		replies:   make(chan string, 64),
+		published: make(chan *api.Event, 64),
+	}
+	// The mock owns the client connection so publish streams opened by the subscriber
+	// are never closed and a graceful shutdown of the mock would block forever.
+	t.Cleanup(func() { go e.srv.Shutdown() })
+
+	e.handler.OnAck = func(*api.Ack) error {
+		e.replies <- "ack"
+		return nil
+	}
+	e.handler.OnNack = func(in *api.Nack) error {
+		e.replies <- in.Code.String()
+		return nil
+	}
+	e.srv.OnSubscribe = e.handler.OnSubscribe
+
+	conf.Topic = "noaa-alerts"
+	conf.Interval = 5 * time.Minute
+	topics := map[string]ulid.ULID{conf.Topic: ulid.Make()}
+	if conf.DeadLetter.Topic != "" {
+		topics[conf.DeadLetter.Topic] = ulid.Make()
+	}
+
+	publisher := ensignmock.NewPublishHandler(topics)
+	ack := publisher.OnEvent
+	publisher.OnEvent = func(in *api.EventWrapper) (*api.PublisherReply, error) {
+		event, err := in.Unwrap()
+		require.NoError(t, err)
+		e.published <- event
+		return ack(in)
+	}
+	e.srv.OnPublish = publisher.OnPublish
+
+	conf, err := conf.Mark()
+	require.NoError(t, err)
+
+	e.sub, err = noaalert.NewAlerts(conf, sdk.WithMock(e.srv))
+	require.NoError(t, err)
+	t.Cleanup(func() { e.sub.Close() })
+	return e
+}
+
+// Send the alert event to the subscription.
+func (e *ensignTest) send(event *noaalert.AlertEvent) {
+	env := ensignmock.NewEventWrapper()
+	env.Wrap(event.Event().Proto())
+	e.handler.Send <- env
+}
+
+func TestListen(t *testing.T) {
+	e := ensignSubscriber(t, noaalert.Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	alerts, err := e.sub.Listen(ctx)
+	require.NoError(t, err)
+
+	// Events that are not alerts are nacked and not sent on the channel
+	e.handler.Send <- ensignmock.NewEventWrapper()
+	e.send(alertEvent(t, &noaalert.Alert{ID: "alert-1", MessageType: noaalert.MessageTypeAlert}))
+	require.Equal(t, api.Nack_UNKNOWN_TYPE.String(), <-e.replies)
+
+	select {
+	case alert := <-alerts:
+		require.Equal(t, noaalert.AlertIssuedType.Name, alert.EventType().Name)
+		require.Equal(t, "ack", <-e.replies)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for alert")
+	}
+
+	// Cancelling the context closes the channel without an error
+	cancel()
+	select {
+	case _, ok := <-alerts:
+		require.False(t, ok, "expected the alerts channel to be closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the alerts channel to close")
+	}
+	require.NoError(t, e.sub.Err())
+}
+
+func TestRunCallbackError(t *testing.T) {
+	e := ensignSubscriber(t, noaalert.Config{})
+	for i := 0; i < 3; i++ {
+		e.send(alertEvent(t, &noaalert.Alert{ID: "alert"}))
+	}
+
+	done := make(chan error, 1)
+	failed := errors.New("callback failed")
+	go func() {
+		done <- e.sub.Run(func(*noaalert.AlertEvent) error {
+			return failed
+		})
+	}()
+
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, failed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after the callback failed")
+	}
+}
+
+func TestRunOrdered(t *testing.T) {
+	e := ensignSubscriber(t, noaalert.Config{Subscriber: noaalert.SubscriberConfig{Workers: 4, Ordered: true}})
+
+	// Two chains of alerts interleaved with unrelated alerts
+	chains := [][]*noaalert.Alert{
+		{{ID: "a1"}, {ID: "a2", References: []noaalert.Reference{{Identifier: "a1"}}}, {ID: "a3", References: []noaalert.Reference{{Identifier: "a2"}}}},
+		{{ID: "b1"}, {ID: "b2", References: []noaalert.Reference{{Identifier: "b1"}}}},
+	}
+	for i := 0; i < 3; i++ {
+		for _, chain := range chains {
+			if i < len(chain) {
+				e.send(alertEvent(t, chain[i]))
+			}
+		}
+		e.send(alertEvent(t, &noaalert.Alert{ID: fmt.Sprintf("other-%d", i)}))
+	}
+
+	var mu sync.Mutex
+	handled := make([]string, 0, 8)
+	seen := make(chan struct{}, 8)
+	stop := errors.New("stop")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.sub.Run(func(event *noaalert.AlertEvent) error {
+			alert, err := event.Alert()
+			require.NoError(t, err)
+			if alert.ID == "stop" {
+				return stop
+			}
+
+			// Delay the first alert in each chain so that updates would be handled
+			// first if the chain was not ordered.
+			if len(alert.References) == 0 {
+				time.Sleep(50 * time.Millisecond)
+			}
+
+			mu.Lock()
+			handled = append(handled, alert.ID)
+			mu.Unlock()
+			seen <- struct{}{}
+			return nil
+		})
+	}()
+
+	for i := 0; i < 8; i++ {
+		select {
+		case <-seen:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for alerts to be handled")
+		}
+	}
+
+	e.send(alertEvent(t, &noaalert.Alert{ID: "stop"}))
+	require.ErrorIs(t, <-done, stop)
+
+	order := func(ids ...string) []int {
+		mu.Lock()
+		defer mu.Unlock()
+		idx := make([]int, 0, len(ids))
+		for _, id := range ids {
+			for i, h := range handled {
+				if h == id {
+					idx = append(idx, i)
+				}
+			}
+		}
+		return idx
+	}
+
+	require.IsIncreasing(t, order("a1", "a2", "a3"))
+	require.IsIncreasing(t, order("b1", "b2"))
+}
+
+func TestRunParallel(t *testing.T) {
+	e := ensignSubscriber(t, noaalert.Config{Subscriber: noaalert.SubscriberConfig{Workers: 3}})
+	for i := 0; i < 3; i++ {
+		e.send(alertEvent(t, &noaalert.Alert{ID: fmt.Sprintf("alert-%d", i)}))
+	}
+
+	// Every callback blocks until all three are running at the same time
+	var running sync.WaitGroup
+	running.Add(3)
+	barrier := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(barrier)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.sub.Run(func(event *noaalert.AlertEvent) error {
+			running.Done()
+			select {
+			case <-barrier:
+				return errors.New("stop")
+			case <-time.After(5 * time.Second):
+				return errors.New("callbacks were not run in parallel")
+			}
+		})
+	}()
+
+	require.EqualError(t, <-done, "stop")
+}
+
+func TestRunTimeout(t *testing.T) {
+	e := ensignSubscriber(t, noaalert.Config{Subscriber: noaalert.SubscriberConfig{Timeout: 50 * time.Millisecond}})
+	e.send(alertEvent(t, &noaalert.Alert{ID: "alert"}))
+
+	// The worker is busy until a callback that timed out returns
+	var returned int32
+	err := e.sub.Run(func(event *noaalert.AlertEvent) error {
+		<-event.Context().Done()
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&returned, 1)
+		return event.Context().Err()
+	})
+	require.ErrorIs(t, err, noaalert.ErrCallbackTimeout)
+	require.Equal(t, int32(1), atomic.LoadInt32(&returned))
+}
+
+func TestManualAck(t *testing.T) {
+	e := ensignSubscriber(t, noaalert.Config{Subscriber: noaalert.SubscriberConfig{ManualAck: true}})
+	for _, id := range []string{"ack", "nack", "return", "fail"} {
+		e.send(alertEvent(t, &noaalert.Alert{ID: id}))
+	}
+
+	failed := errors.New("callback failed")
+	err := e.sub.Run(func(event *noaalert.AlertEvent) error {
+		alert, err := event.Alert()
+		require.NoError(t, err)
+
+		switch alert.ID {
+		case "ack":
+			return event.Ack()
+		case "nack":
+			return event.Nack(noaalert.NackUnknownType)
+		case "fail":
+			return failed
+		default:
+			return nil
+		}
+	})
+	require.ErrorIs(t, err, failed)
+
+	// Alerts are acked or nacked by the callback, or when the callback returns
+	expected := []string{"ack", api.Nack_UNKNOWN_TYPE.String(), "ack", api.Nack_DELIVER_AGAIN_ANY.String()}
+	for _, reply := range expected {
+		select {
+		case actual := <-e.replies:
+			require.Equal(t, reply, actual)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", reply)
+		}
+	}
+
+	// Alerts that were not received from a subscription cannot be acked
+	require.ErrorIs(t, alertEvent(t, &noaalert.Alert{ID: "alert"}).Ack(), noaalert.ErrNotSubscribed)
+}
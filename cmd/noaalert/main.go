@@ -31,6 +31,33 @@ func main() {
 			Usage:    "run the publisher daemon to fetch alerts from the NOAA API",
 			Category: "server",
 			Action:   publish,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "log the alerts that would be published without connecting to Ensign",
+				},
+			},
+		},
+		{
+			Name:     "backfill",
+			Usage:    "publish alerts issued in a time window that were not already published",
+			Category: "server",
+			Action:   backfill,
+			Flags: []cli.Flag{
+				&cli.TimestampFlag{
+					Name:     "start",
+					Aliases:  []string{"s"},
+					Usage:    "publish alerts issued after this RFC3339 timestamp",
+					Layout:   time.RFC3339,
+					Required: true,
+				},
+				&cli.TimestampFlag{
+					Name:    "end",
+					Aliases: []string{"e"},
+					Usage:   "publish alerts issued before this RFC3339 timestamp (default now)",
+					Layout:  time.RFC3339,
+				},
+			},
 		},
 		{
 			Name:     "info",
@@ -43,12 +70,105 @@ func main() {
 			Category: "utility",
 			Usage:    "subscribe to NOAA alerts on Ensign",
 			Action:   subscribe,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "geofence",
+					Aliases: []string{"g"},
+					Usage:   "only show alerts over the sites in a GeoJSON feature collection",
+				},
+				&cli.StringSliceFlag{
+					Name:    "state",
+					Aliases: []string{"s"},
+					Usage:   "only show alerts for the state/territory or marine area code",
+				},
+				&cli.BoolFlag{
+					Name:  "actual",
+					Usage: "drop test, exercise, system, and draft alerts",
+				},
+				&cli.IntFlag{
+					Name:    "workers",
+					Aliases: []string{"w"},
+					Usage:   "number of alerts to handle concurrently (overrides config)",
+				},
+				&cli.BoolFlag{
+					Name:  "ordered",
+					Usage: "handle alerts in the same chain in the order they were received",
+				},
+				&cli.DurationFlag{
+					Name:  "timeout",
+					Usage: "maximum time to handle an alert (overrides config)",
+				},
+				&cli.BoolFlag{
+					Name:  "manual-ack",
+					Usage: "ack alerts after they are handled instead of when they are received",
+				},
+			},
 		},
 		{
 			Name:     "alerts",
 			Category: "utility",
 			Usage:    "get active NOAA alerts",
 			Action:   alerts,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:    "area",
+					Aliases: []string{"a"},
+					Usage:   "filter by state/territory or marine area code",
+				},
+				&cli.StringSliceFlag{
+					Name:    "zone",
+					Aliases: []string{"z"},
+					Usage:   "filter by forecast or county zone id",
+				},
+				&cli.StringFlag{
+					Name:    "point",
+					Aliases: []string{"p"},
+					Usage:   "filter by a point specified as lat,lon",
+				},
+				&cli.StringSliceFlag{
+					Name:  "region",
+					Usage: "filter by marine region code",
+				},
+				&cli.StringFlag{
+					Name:  "region-type",
+					Usage: "filter by land or marine region type",
+				},
+				&cli.StringSliceFlag{
+					Name:    "event",
+					Aliases: []string{"e"},
+					Usage:   "filter by event name",
+				},
+				&cli.StringSliceFlag{
+					Name:    "severity",
+					Aliases: []string{"s"},
+					Usage:   "filter by severity (extreme, severe, moderate, minor, unknown)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "urgency",
+					Usage: "filter by urgency (immediate, expected, future, past, unknown)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "certainty",
+					Usage: "filter by certainty (observed, likely, possible, unlikely, unknown)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "status",
+					Usage: "filter by status (actual, exercise, system, test, draft)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "message-type",
+					Usage: "filter by message type (alert, update, cancel)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "code",
+					Usage: "filter by event code",
+				},
+				&cli.IntFlag{
+					Name:    "limit",
+					Aliases: []string{"l"},
+					Usage:   "limit the number of alerts returned",
+				},
+			},
 		},
 		{
 			Name:     "query",
@@ -73,6 +193,30 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:     "dlq",
+			Category: "utility",
+			Usage:    "inspect and redrive alerts on the dead-letter topic",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "list",
+					Usage:  "list the dead-lettered alerts",
+					Action: dlqList,
+					Flags:  dlqFlags,
+				},
+				{
+					Name:   "redrive",
+					Usage:  "republish dead-lettered alerts to the alerts topic",
+					Action: dlqRedrive,
+					Flags: append([]cli.Flag{
+						&cli.StringSliceFlag{
+							Name:  "id",
+							Usage: "only redrive the dead letters with these ids (default all)",
+						},
+					}, dlqFlags...),
+				},
+			},
+		},
 		{
 			Name:     "config",
 			Usage:    "print noaalerts configuration guide",
@@ -94,8 +238,14 @@ func main() {
 }
 
 func publish(c *cli.Context) (err error) {
+	// Applied before the config is validated so that the sink settings are not required
+	opts := make([]noaalert.ConfigOption, 0, 1)
+	if c.Bool("dry-run") {
+		opts = append(opts, noaalert.WithDryRun())
+	}
+
 	var conf noaalert.Config
-	if conf, err = noaalert.NewConfig(); err != nil {
+	if conf, err = noaalert.NewConfig(opts...); err != nil {
 		return cli.Exit(err, 1)
 	}
 
@@ -110,37 +260,110 @@ func publish(c *cli.Context) (err error) {
 	return nil
 }
 
+func backfill(c *cli.Context) (err error) {
+	var conf noaalert.Config
+	if conf, err = noaalert.NewConfig(); err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	var start, end time.Time
+	start = *c.Timestamp("start")
+	if ts := c.Timestamp("end"); ts != nil {
+		end = *ts
+	}
+
+	var pub *noaalert.Publisher
+	if pub, err = noaalert.New(conf); err != nil {
+		return cli.Exit(err, 1)
+	}
+	defer pub.Shutdown()
+
+	var stats noaalert.PublishStats
+	if stats, err = pub.Backfill(c.Context, start, end); err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	fmt.Printf("published %d alerts (%d acked, %d dropped)\n", stats.Published, stats.Acked, stats.Dropped)
+	return nil
+}
+
 func subscribe(c *cli.Context) (err error) {
 	var conf noaalert.Config
 	if conf, err = noaalert.NewConfig(); err != nil {
 		return cli.Exit(err, 1)
 	}
 
+	if c.IsSet("workers") {
+		conf.Subscriber.Workers = c.Int("workers")
+	}
+	if c.IsSet("ordered") {
+		conf.Subscriber.Ordered = c.Bool("ordered")
+	}
+	if c.IsSet("timeout") {
+		conf.Subscriber.Timeout = c.Duration("timeout")
+	}
+	if c.IsSet("manual-ack") {
+		conf.Subscriber.ManualAck = c.Bool("manual-ack")
+	}
+
 	var sub *noaalert.Subscriber
 	if sub, err = noaalert.NewAlerts(conf); err != nil {
 		return cli.Exit(err, 1)
 	}
+	defer sub.Close()
 
-	err = sub.Run(func(alert *noaalert.AlertEvent) (err error) {
+	handler := func(alert *noaalert.AlertEvent) (err error) {
 		var headline string
 		if headline, err = alert.Headline(); err != nil {
 			log.Warn().Err(err).Msg("could not get headline from alert")
 			return nil
 		}
 
-		log.Info().Msg(headline)
+		logctx := log.Info().Str("type", alert.EventType().Name)
+		if diff, err := alert.Diff(); err == nil {
+			logctx = logctx.Str("changes", diff.Summary())
+		}
+		if len(alert.Sites) > 0 {
+			logctx = logctx.Strs("sites", alert.Sites)
+		}
+		logctx.Msg(headline)
 		return nil
-	})
+	}
 
-	if err != nil {
+	middleware := []noaalert.Middleware{noaalert.Recover()}
+	if states := c.StringSlice("state"); len(states) > 0 {
+		middleware = append(middleware, noaalert.Filter(noaalert.InState(states...)))
+	}
+	if c.Bool("actual") {
+		middleware = append(middleware, noaalert.Filter(noaalert.IsActual()))
+	}
+
+	if path := c.String("geofence"); path != "" {
+		var sites []noaalert.Site
+		if sites, err = noaalert.LoadSites(path); err != nil {
+			return cli.Exit(err, 1)
+		}
+		var zones *noaalert.Weather
+		if zones, err = noaalert.NewWeatherAPI(conf.Weather.Options()...); err != nil {
+			return cli.Exit(err, 1)
+		}
+		middleware = append(middleware, noaalert.NewGeofence(sites, zones).Middleware())
+	}
+
+	if err = sub.Run(noaalert.Chain(handler, middleware...)); err != nil {
 		return cli.Exit(err, 1)
 	}
 	return nil
 }
 
 func alerts(c *cli.Context) (err error) {
+	var conf noaalert.WeatherConfig
+	if conf, err = noaalert.NewWeatherConfig(); err != nil {
+		return cli.Exit(err, 1)
+	}
+
 	var api *noaalert.Weather
-	if api, err = noaalert.NewWeatherAPI(); err != nil {
+	if api, err = noaalert.NewWeatherAPI(conf.Options()...); err != nil {
 		return cli.Exit(err, 1)
 	}
 
@@ -148,10 +371,15 @@ func alerts(c *cli.Context) (err error) {
 	defer cancel()
 
 	var events []*noaalert.AlertEvent
-	if events, err = api.Alerts(ctx); err != nil {
+	if events, err = api.Alerts(ctx, alertsQuery(c)); err != nil {
 		return cli.Exit(err, 1)
 	}
 
+	// The active alerts endpoint does not support a limit so it is applied here.
+	if limit := c.Int("limit"); limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+
 	for _, event := range events {
 		var headline string
 		if headline, err = event.Headline(); err != nil {
@@ -162,6 +390,143 @@ func alerts(c *cli.Context) (err error) {
 	return nil
 }
 
+func alertsQuery(c *cli.Context) *noaalert.AlertsQuery {
+	return &noaalert.AlertsQuery{
+		Area:        c.StringSlice("area"),
+		Zone:        c.StringSlice("zone"),
+		Point:       c.String("point"),
+		Region:      c.StringSlice("region"),
+		RegionType:  c.String("region-type"),
+		Event:       c.StringSlice("event"),
+		Severity:    c.StringSlice("severity"),
+		Urgency:     c.StringSlice("urgency"),
+		Certainty:   c.StringSlice("certainty"),
+		Status:      c.StringSlice("status"),
+		MessageType: c.StringSlice("message-type"),
+		Code:        c.StringSlice("code"),
+	}
+}
+
+var dlqFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:    "offset",
+		Aliases: []string{"O"},
+		Value:   0,
+	},
+	&cli.IntFlag{
+		Name:    "limit",
+		Aliases: []string{"l"},
+		Value:   100,
+	},
+}
+
+// Query the dead letters on the configured dead-letter topic. The caller must close the
+// returned client; it is closed before returning if the dead letters cannot be queried.
+func deadLetters(c *cli.Context) (_ noaalert.Config, _ *ensign.Client, letters []*noaalert.DeadLetter, err error) {
+	var conf noaalert.Config
+	if conf, err = noaalert.NewConfig(); err != nil {
+		return conf, nil, nil, err
+	}
+
+	if conf.DeadLetter.Topic == "" {
+		return conf, nil, nil, noaalert.ErrNoDeadLetter
+	}
+
+	var client *ensign.Client
+	if client, err = ensign.New(conf.Ensign.Options()...); err != nil {
+		return conf, nil, nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			client.Close()
+		}
+	}()
+
+	var events *noaalert.AlertIterator
+	if events, err = noaalert.QueryDeadLetters(client, conf.DeadLetter.Topic, c.Int("offset"), c.Int("limit")); err != nil {
+		return conf, nil, nil, err
+	}
+	defer events.Release()
+
+	for events.Next() {
+		var letter *noaalert.DeadLetter
+		if letter, err = noaalert.ParseDeadLetter(events.Alert()); err != nil {
+			log.Warn().Err(err).Msg("skipping event on dead-letter topic")
+			continue
+		}
+		letters = append(letters, letter)
+	}
+
+	if err = events.Error(); err != nil {
+		return conf, nil, nil, err
+	}
+	return conf, client, letters, nil
+}
+
+func dlqList(c *cli.Context) (err error) {
+	var (
+		client  *ensign.Client
+		letters []*noaalert.DeadLetter
+	)
+	if _, client, letters, err = deadLetters(c); err != nil {
+		return cli.Exit(err, 1)
+	}
+	defer client.Close()
+
+	tabs := tabwriter.NewWriter(os.Stdout, 1, 0, 4, ' ', 0)
+	fmt.Fprintln(tabs, "ID\tFAILED\tREASON\tATTEMPTS\tALERT\tERROR")
+	for _, letter := range letters {
+		alert := letter.EventID
+		if data, err := letter.Alert().Alert(); err == nil {
+			alert = data.ID
+		}
+		fmt.Fprintf(tabs, "%s\t%s\t%s\t%d\t%s\t%s\n", letter.ID, letter.Failed.Format(time.RFC3339), letter.Reason, letter.Attempts, alert, letter.Error)
+	}
+	tabs.Flush()
+	return nil
+}
+
+func dlqRedrive(c *cli.Context) (err error) {
+	var (
+		conf    noaalert.Config
+		client  *ensign.Client
+		letters []*noaalert.DeadLetter
+	)
+	if conf, client, letters, err = deadLetters(c); err != nil {
+		return cli.Exit(err, 1)
+	}
+	defer client.Close()
+
+	if ids := c.StringSlice("id"); len(ids) > 0 {
+		filter := make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			filter[id] = struct{}{}
+		}
+
+		selected := make([]*noaalert.DeadLetter, 0, len(ids))
+		for _, letter := range letters {
+			if _, ok := filter[letter.ID]; ok {
+				selected = append(selected, letter)
+			}
+		}
+		letters = selected
+	}
+
+	if len(letters) == 0 {
+		fmt.Println("no dead letters to redrive")
+		return nil
+	}
+
+	if err = noaalert.Redrive(client, conf.Topic, letters...); err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	// Ensign topics are append-only so redriven alerts remain on the dead-letter topic.
+	fmt.Printf("redrove %d dead letters to %s\n", len(letters), conf.Topic)
+	return nil
+}
+
 func usage(c *cli.Context) (err error) {
 	tabs := tabwriter.NewWriter(os.Stdout, 1, 0, 4, ' ', 0)
 	format := confire.DefaultTableFormat
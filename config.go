@@ -2,6 +2,7 @@ package noaalert
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
@@ -12,28 +13,127 @@ import (
 
 const prefix = "noaalert"
 
+// Bounds of the polling interval if they are not configured; the bounds are widened to
+// include the base interval so that any interval is valid without configuring them.
+const (
+	defaultIntervalMin = time.Minute
+	defaultIntervalMax = 15 * time.Minute
+)
+
 type Config struct {
-	Topic             string        `default:"noaa-alerts" required:"true"`
-	EnsureTopicExists bool          `split_words:"true" default:"false"`
-	Interval          time.Duration `default:"5m" required:"true"`
-	ConsoleLog        bool          `split_words:"true" default:"false"`
-	LogLevel          LevelDecoder  `default:"info" split_words:"true"`
+	Topic             string         `default:"noaa-alerts" required:"true"`
+	EnsureTopicExists bool           `split_words:"true" default:"false"`
+	Interval          time.Duration  `default:"5m" required:"true"`
+	IntervalMin       time.Duration  `split_words:"true"`
+	IntervalMax       time.Duration  `split_words:"true"`
+	IntervalJitter    float64        `split_words:"true" default:"0.1"`
+	ConsoleLog        bool           `split_words:"true" default:"false"`
+	LogLevel          LevelDecoder   `default:"info" split_words:"true"`
+	StorePath         string         `split_words:"true"`
+	StoreRetention    time.Duration  `split_words:"true" default:"72h"`
+	AckTimeout        time.Duration  `split_words:"true" default:"30s"`
+	PublishRetries    int            `split_words:"true" default:"3"`
+	PublishBackoff    time.Duration  `split_words:"true" default:"1s"`
+	EnrichGeometry    bool           `split_words:"true" default:"false"`
+	DryRun            bool           `split_words:"true" default:"false"`
+	Sinks             []string       `default:"ensign"`
+	FileSink          FileSinkConfig `split_words:"true"`
+	Webhook           WebhookConfig
+	Alerts            AlertsQuery
+	Weather           WeatherConfig
+	Subscriber        SubscriberConfig
+	DeadLetter        DeadLetterConfig `split_words:"true"`
 	Ensign            EnsignConfig
 	processed         bool
 }
 
+// WeatherConfig configures the client used to make requests to api.weather.gov. The
+// NWS asks that every operator identify themselves with a unique User-Agent that
+// includes contact information; the publisher requires it but one-off queries use the
+// package default if it is not set. A timeout of zero disables the request timeout; if
+// the timeout is not set the client default is used. If a replay path is set, recorded
+// responses are served instead of making requests so that the publisher runs offline.
+type WeatherConfig struct {
+	UserAgent      string         `split_words:"true"`
+	BaseURL        string         `split_words:"true" default:"https://api.weather.gov"`
+	Timeout        *time.Duration `default:"30s"`
+	Proxy          string
+	AcceptLanguage string `split_words:"true" default:"en-US,en"`
+	ZoneCache      string `split_words:"true"`
+	Replay         string
+}
+
+// SubscriberConfig configures how the Subscriber runs callbacks. Alerts are handled by
+// a pool of workers; if ordered, alerts in the same chain (an alert and the alerts that
+// update or cancel it) are handled in the order they were received while unrelated
+// alerts are handled in parallel. A timeout of zero means callbacks have no deadline.
+// Callback errors stop the subscriber unless it is configured to continue on errors.
+// Alerts are acked when they are received unless manual acks are enabled, in which case
+// they are acked or nacked by the callback, or when the callback returns.
+type SubscriberConfig struct {
+	Workers         int           `default:"1"`
+	Ordered         bool          `default:"false"`
+	Timeout         time.Duration `default:"0"`
+	ContinueOnError bool          `split_words:"true" default:"false"`
+	ManualAck       bool          `split_words:"true" default:"false"`
+}
+
+// DeadLetterConfig configures the topic that events the subscriber could not handle are
+// published to. Callbacks are attempted up to the maximum number of times, waiting for
+// the backoff between attempts, before the alert is dead-lettered. The backoff is
+// doubled after every attempt. Dead letters are disabled if no topic is configured.
+type DeadLetterConfig struct {
+	Topic       string
+	MaxAttempts int           `split_words:"true" default:"3"`
+	Backoff     time.Duration `default:"1s"`
+}
+
+// FileSinkConfig configures the file sink, which appends alerts as JSON lines to a
+// file that is rotated when it exceeds the maximum size.
+type FileSinkConfig struct {
+	Path       string
+	MaxSize    int64 `split_words:"true" default:"104857600"`
+	MaxBackups int   `split_words:"true" default:"5"`
+}
+
+// WebhookConfig configures the webhook sink, which posts alerts to an HTTP endpoint.
+type WebhookConfig struct {
+	URL     string
+	Timeout time.Duration `default:"10s"`
+	Headers map[string]string
+}
+
 type EnsignConfig struct {
-	ClientID     string `env:"ENSIGN_CLIENT_ID" required:"true"`
-	ClientSecret string `env:"ENSIGN_CLIENT_SECRET" required:"true"`
+	ClientID     string `env:"ENSIGN_CLIENT_ID"`
+	ClientSecret string `env:"ENSIGN_CLIENT_SECRET"`
 	Endpoint     string `env:"ENSIGN_ENDPOINT"`
 	AuthURL      string `env:"ENSIGN_AUTH_URL"`
 }
 
-func NewConfig() (conf Config, err error) {
+// ConfigOption modifies the configuration after it is loaded from the environment and
+// before it is validated, e.g. to apply command line flags.
+type ConfigOption func(conf *Config)
+
+// WithDryRun enables dry-run mode so that the sink settings are not required.
+func WithDryRun() ConfigOption {
+	return func(conf *Config) {
+		conf.DryRun = true
+	}
+}
+
+func NewConfig(opts ...ConfigOption) (conf Config, err error) {
 	if err = confire.Process(prefix, &conf); err != nil {
 		return conf, err
 	}
 
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	if err = conf.Validate(); err != nil {
+		return conf, err
+	}
+
 	conf.processed = true
 	return conf, nil
 }
@@ -55,9 +155,139 @@ func (c Config) Mark() (Config, error) {
 // Validates the config is ready for use in the application and that configuration
 // semantics such as requiring multiple required configuration parameters are enforced.
 func (c Config) Validate() (err error) {
+	if (c.IntervalMin > 0 && c.IntervalMin > c.Interval) || (c.IntervalMax > 0 && c.IntervalMax < c.Interval) {
+		return ErrInvalidInterval
+	}
+
+	if c.IntervalJitter < 0 || c.IntervalJitter >= 1 {
+		return ErrInvalidJitter
+	}
+
+	if err = c.Alerts.Validate(); err != nil {
+		return err
+	}
+
+	if err = c.Weather.Validate(); err != nil {
+		return err
+	}
+
+	if c.Subscriber.Workers < 0 || c.Subscriber.Timeout < 0 {
+		return ErrInvalidSubscriber
+	}
+
+	// A dry run does not open the configured sinks so their settings are not required.
+	if c.DryRun {
+		return nil
+	}
+
+	for _, sink := range c.Sinks {
+		switch strings.ToLower(strings.TrimSpace(sink)) {
+		case SinkEnsign:
+			if c.Ensign.ClientID == "" || c.Ensign.ClientSecret == "" {
+				return fmt.Errorf("%w: ensign sink requires a client id and secret", ErrInvalidSink)
+			}
+		case SinkStdout:
+		case SinkFile:
+			if c.FileSink.Path == "" {
+				return fmt.Errorf("%w: file sink requires a path", ErrInvalidSink)
+			}
+		case SinkWebhook:
+			if c.Webhook.URL == "" {
+				return fmt.Errorf("%w: webhook sink requires a url", ErrInvalidSink)
+			}
+		default:
+			return fmt.Errorf("%w: unknown sink %q", ErrInvalidSink, sink)
+		}
+	}
+	return nil
+}
+
+// IntervalBounds returns the minimum and maximum polling intervals, using the defaults
+// for bounds that are not configured as long as they include the base interval.
+func (c Config) IntervalBounds() (min, max time.Duration) {
+	if min = c.IntervalMin; min <= 0 {
+		min = defaultIntervalMin
+		if min > c.Interval {
+			min = c.Interval
+		}
+	}
+
+	if max = c.IntervalMax; max <= 0 {
+		max = defaultIntervalMax
+		if max < c.Interval {
+			max = c.Interval
+		}
+	}
+	return min, max
+}
+
+// NewWeatherConfig loads only the weather client configuration from the environment,
+// for commands that query the NWS API without requiring the Ensign credentials.
+func NewWeatherConfig() (conf WeatherConfig, err error) {
+	if err = confire.Process(prefix+"_weather", &conf); err != nil {
+		return conf, err
+	}
+
+	if err = conf.Validate(); err != nil {
+		return conf, err
+	}
+	return conf, nil
+}
+
+func (c WeatherConfig) Validate() (err error) {
+	if c.BaseURL != "" {
+		var u *url.URL
+		if u, err = url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%w: base url must be an absolute url", ErrInvalidWeather)
+		}
+	}
+
+	if c.Proxy != "" {
+		if _, err = url.Parse(c.Proxy); err != nil {
+			return fmt.Errorf("%w: could not parse proxy url", ErrInvalidWeather)
+		}
+	}
+
+	if c.Timeout != nil && *c.Timeout < 0 {
+		return fmt.Errorf("%w: timeout cannot be negative", ErrInvalidWeather)
+	}
 	return nil
 }
 
+// Options returns the options to create a Weather client from the configuration.
+func (c WeatherConfig) Options() []WeatherOption {
+	opts := make([]WeatherOption, 0, 7)
+	if c.UserAgent != "" {
+		opts = append(opts, WithUserAgent(c.UserAgent))
+	}
+
+	if c.BaseURL != "" {
+		opts = append(opts, WithBaseURL(c.BaseURL))
+	}
+
+	if c.Timeout != nil {
+		opts = append(opts, WithTimeout(*c.Timeout))
+	}
+
+	if c.Proxy != "" {
+		opts = append(opts, WithProxy(c.Proxy))
+	}
+
+	if c.AcceptLanguage != "" {
+		opts = append(opts, WithAcceptLanguage(c.AcceptLanguage))
+	}
+
+	if c.ZoneCache != "" {
+		opts = append(opts, WithZoneCache(c.ZoneCache))
+	}
+
+	// The replay transport replaces the transport configured by the other options.
+	if c.Replay != "" {
+		opts = append(opts, WithReplay(c.Replay))
+	}
+	return opts
+}
+
 func (c EnsignConfig) Options() []sdk.Option {
 	opts := make([]sdk.Option, 0, 3)
 	opts = append(opts, sdk.WithCredentials(c.ClientID, c.ClientSecret))
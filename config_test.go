@@ -16,6 +16,13 @@ var testEnv = map[string]string{
 	"NOAALERT_INTERVAL":            "1m",
 	"NOAALERT_LOG_LEVEL":           "warn",
 	"NOAALERT_CONSOLE_LOG":         "true",
+	"NOAALERT_ALERTS_AREA":         "MA,NH",
+	"NOAALERT_ALERTS_SEVERITY":     "Severe,Extreme",
+	"NOAALERT_ALERTS_MESSAGE_TYPE": "alert",
+	"NOAALERT_WEATHER_USER_AGENT":  "(example.com, ops@example.com)",
+	"NOAALERT_WEATHER_TIMEOUT":     "10s",
+	"NOAALERT_SINKS":               "ensign,file",
+	"NOAALERT_FILE_SINK_PATH":      "/tmp/noaalert/alerts.jsonl",
 	"ENSIGN_CLIENT_ID":             "abcdefg1234",
 	"ENSIGN_CLIENT_SECRET":         "abcdefghijklmnopqrstuvwxyz1234567",
 	"ENSIGN_ENDPOINT":              "localhost:8000",
@@ -41,6 +48,38 @@ func TestConfig(t *testing.T) {
 	require.Equal(t, testEnv["ENSIGN_ENDPOINT"], conf.Ensign.Endpoint)
 	require.Equal(t, testEnv["ENSIGN_AUTH_URL"], conf.Ensign.AuthURL)
 	require.True(t, conf.ConsoleLog)
+	require.Equal(t, []string{"MA", "NH"}, conf.Alerts.Area)
+	require.Equal(t, []string{"Severe", "Extreme"}, conf.Alerts.Severity)
+	require.Equal(t, []string{"alert"}, conf.Alerts.MessageType)
+	require.Equal(t, testEnv["NOAALERT_WEATHER_USER_AGENT"], conf.Weather.UserAgent)
+	require.Equal(t, noaalert.BaseWeatherURL, conf.Weather.BaseURL)
+	require.Equal(t, 10*time.Second, *conf.Weather.Timeout)
+	require.Equal(t, "en-US,en", conf.Weather.AcceptLanguage)
+	require.Equal(t, []string{"ensign", "file"}, conf.Sinks)
+	require.Equal(t, testEnv["NOAALERT_FILE_SINK_PATH"], conf.FileSink.Path)
+	require.Equal(t, int64(104857600), conf.FileSink.MaxSize)
+	require.Equal(t, 1, conf.Subscriber.Workers)
+	require.False(t, conf.Subscriber.ContinueOnError)
+	require.Equal(t, 3, conf.DeadLetter.MaxAttempts)
+	require.Equal(t, time.Second, conf.DeadLetter.Backoff)
+}
+
+func TestConfigDryRun(t *testing.T) {
+	t.Cleanup(cleanupEnv())
+	t.Cleanup(cleanupEnv("NOAALERT_DRY_RUN"))
+	setEnv()
+	os.Unsetenv("ENSIGN_CLIENT_SECRET")
+	os.Unsetenv("NOAALERT_DRY_RUN")
+
+	// The ensign sink requires credentials unless this is a dry run
+	_, err := noaalert.NewConfig()
+	require.ErrorIs(t, err, noaalert.ErrInvalidSink)
+
+	conf, err := noaalert.NewConfig(noaalert.WithDryRun())
+	require.NoError(t, err)
+	require.True(t, conf.DryRun)
+	_, ok := os.LookupEnv("NOAALERT_DRY_RUN")
+	require.False(t, ok, "the environment should not be modified")
 }
 
 func TestOptions(t *testing.T) {
@@ -53,6 +92,44 @@ func TestOptions(t *testing.T) {
 
 	opts := conf.Ensign.Options()
 	require.Len(t, opts, 3)
+
+	wopts := conf.Weather.Options()
+	require.Len(t, wopts, 4)
+
+	// A zero timeout is applied to disable the request timeout
+	zero := time.Duration(0)
+	wopts = noaalert.WeatherConfig{Timeout: &zero}.Options()
+	require.Len(t, wopts, 1)
+	require.Empty(t, noaalert.WeatherConfig{}.Options())
+	require.Len(t, noaalert.WeatherConfig{Replay: "testdata/response.txt.gz"}.Options(), 1)
+}
+
+func TestIntervalBounds(t *testing.T) {
+	testCases := []struct {
+		conf     noaalert.Config
+		min, max time.Duration
+		err      error
+	}{
+		{noaalert.Config{Interval: 5 * time.Minute}, time.Minute, 15 * time.Minute, nil},
+		{noaalert.Config{Interval: 30 * time.Second}, 30 * time.Second, 15 * time.Minute, nil},
+		{noaalert.Config{Interval: time.Hour}, time.Minute, time.Hour, nil},
+		{noaalert.Config{Interval: 5 * time.Minute, IntervalMin: 2 * time.Minute, IntervalMax: time.Hour}, 2 * time.Minute, time.Hour, nil},
+		{noaalert.Config{Interval: 30 * time.Second, IntervalMin: time.Minute}, 0, 0, noaalert.ErrInvalidInterval},
+		{noaalert.Config{Interval: time.Hour, IntervalMax: 15 * time.Minute}, 0, 0, noaalert.ErrInvalidInterval},
+	}
+
+	for i, tc := range testCases {
+		tc.conf.Sinks = []string{noaalert.SinkStdout}
+		if tc.err != nil {
+			require.ErrorIs(t, tc.conf.Validate(), tc.err, "test case %d", i)
+			continue
+		}
+
+		require.NoError(t, tc.conf.Validate(), "test case %d", i)
+		min, max := tc.conf.IntervalBounds()
+		require.Equal(t, tc.min, min, "test case %d", i)
+		require.Equal(t, tc.max, max, "test case %d", i)
+	}
 }
 
 func TestLevelDecoder(t *testing.T) {
@@ -0,0 +1,228 @@
+package noaalert
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rotationalio/go-ensign"
+	api "github.com/rotationalio/go-ensign/api/v1beta1"
+	mimetype "github.com/rotationalio/go-ensign/mimetype/v1beta1"
+	"github.com/rs/zerolog/log"
+)
+
+// Reasons that an event was dead-lettered, included in the metadata of dead letters.
+const (
+	DeadLetterUnknownType       = "unknown_type"
+	DeadLetterUnhandledMimetype = "unhandled_mimetype"
+	DeadLetterUnparseable       = "unparseable"
+	DeadLetterHandlerFailed     = "handler_failed"
+	DeadLetterTimeout           = "timeout"
+)
+
+// DeadLetterType is the type of the events published to the dead-letter topic. The data
+// of a dead letter is the data of the original event; the original type, mimetype, and
+// the reason that the event failed are stored in the metadata.
+var DeadLetterType = &api.Type{Name: "AlertDeadLetter", MajorVersion: 1}
+
+// Metadata keys of dead letters; the attempts key is kept when an event is redriven so
+// that the attempt count continues if the event fails again.
+const (
+	dlqPrefix      = "dlq_"
+	dlqReason      = "dlq_reason"
+	dlqError       = "dlq_error"
+	dlqAttempts    = "dlq_attempts"
+	dlqTopic       = "dlq_topic"
+	dlqEventID     = "dlq_event_id"
+	dlqFailed      = "dlq_failed"
+	dlqType        = "dlq_type"
+	dlqTypeVersion = "dlq_type_version"
+	dlqMimetype    = "dlq_mimetype"
+)
+
+// Timeout for Ensign to ack a dead letter or a redriven event.
+const deadLetterTimeout = 30 * time.Second
+
+// DeadLetter is an event that could not be handled by a subscriber.
+type DeadLetter struct {
+	ID       string        // ID of the dead letter on the dead-letter topic
+	Reason   string        // Why the event failed, one of the DeadLetter reasons
+	Error    string        // The error that caused the event to fail, if any
+	Attempts int           // Number of times the event was handled, including redrives
+	Topic    string        // Topic the event was received on
+	EventID  string        // ID of the event on the topic it was received on
+	Failed   time.Time     // When the event was dead-lettered
+	Event    *ensign.Event // The original event without the dead letter metadata
+}
+
+// Create a dead letter for an event received from the topic.
+func newDeadLetterEvent(event *ensign.Event, topic, reason string, cause error, attempts int) *ensign.Event {
+	meta := make(ensign.Metadata, len(event.Metadata)+8)
+	for key, val := range event.Metadata {
+		meta[key] = val
+	}
+
+	meta[dlqReason] = reason
+	meta[dlqAttempts] = strconv.Itoa(attempts)
+	meta[dlqTopic] = topic
+	meta[dlqEventID] = event.ID()
+	meta[dlqFailed] = time.Now().UTC().Format(time.RFC3339)
+	meta[dlqMimetype] = event.Mimetype.MimeType()
+
+	if cause != nil {
+		meta[dlqError] = cause.Error()
+	}
+
+	if event.Type != nil {
+		meta[dlqType] = event.Type.Name
+		meta[dlqTypeVersion] = event.Type.Semver()
+	}
+
+	return &ensign.Event{
+		Type:     DeadLetterType,
+		Mimetype: event.Mimetype,
+		Metadata: meta,
+		Data:     event.Data,
+	}
+}
+
+// ParseDeadLetter returns the dead letter from an event on the dead-letter topic.
+func ParseDeadLetter(event *AlertEvent) (letter *DeadLetter, err error) {
+	if event.Type == nil || event.Type.Name != DeadLetterType.Name {
+		return nil, ErrNotDeadLetter
+	}
+
+	letter = &DeadLetter{
+		Reason:  event.Metadata[dlqReason],
+		Error:   event.Metadata[dlqError],
+		Topic:   event.Metadata[dlqTopic],
+		EventID: event.Metadata[dlqEventID],
+		Event: &ensign.Event{
+			Metadata: make(ensign.Metadata, len(event.Metadata)),
+			Data:     event.Data,
+		},
+	}
+
+	if event.event != nil {
+		letter.ID = event.event.ID()
+	}
+
+	if letter.Attempts, err = strconv.Atoi(event.Metadata[dlqAttempts]); err != nil {
+		return nil, fmt.Errorf("could not parse dead letter attempts: %w", err)
+	}
+
+	if letter.Failed, err = time.Parse(time.RFC3339, event.Metadata[dlqFailed]); err != nil {
+		return nil, fmt.Errorf("could not parse dead letter failed timestamp: %w", err)
+	}
+
+	if letter.Event.Mimetype, err = mimetype.Parse(event.Metadata[dlqMimetype]); err != nil {
+		return nil, fmt.Errorf("could not parse dead letter mimetype: %w", err)
+	}
+
+	if name := event.Metadata[dlqType]; name != "" {
+		letter.Event.Type = &api.Type{Name: name}
+		if err = letter.Event.Type.ParseSemver(event.Metadata[dlqTypeVersion]); err != nil {
+			return nil, fmt.Errorf("could not parse dead letter type: %w", err)
+		}
+	}
+
+	for key, val := range event.Metadata {
+		if !strings.HasPrefix(key, dlqPrefix) {
+			letter.Event.Metadata[key] = val
+		}
+	}
+	return letter, nil
+}
+
+// Alert returns the original event as an alert, e.g. to inspect the alert data.
+func (d *DeadLetter) Alert() *AlertEvent {
+	return newAlertEvent(d.Event)
+}
+
+// QueryDeadLetters returns the events on the dead-letter topic; use ParseDeadLetter to
+// read the dead letter from each event.
+func QueryDeadLetters(client *ensign.Client, topic string, offset, limit int) (*AlertIterator, error) {
+	return queryTopic(client, topic, offset, limit)
+}
+
+// Redrive republishes the original events of the dead letters to the topic and waits
+// for them to be acked. The attempt count of each dead letter is kept on the event so
+// that it continues if the event is dead-lettered again.
+func Redrive(client *ensign.Client, topic string, letters ...*DeadLetter) (err error) {
+	events := make([]*ensign.Event, 0, len(letters))
+	for _, letter := range letters {
+		event := &ensign.Event{
+			Type:     letter.Event.Type,
+			Mimetype: letter.Event.Mimetype,
+			Metadata: make(ensign.Metadata, len(letter.Event.Metadata)+1),
+			Data:     letter.Event.Data,
+		}
+
+		for key, val := range letter.Event.Metadata {
+			event.Metadata[key] = val
+		}
+		event.Metadata[dlqAttempts] = strconv.Itoa(letter.Attempts)
+		events = append(events, event)
+	}
+
+	if err = client.Publish(topic, events...); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterTimeout)
+	defer cancel()
+
+	for _, event := range events {
+		if err = waitForAck(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the number of times the event was handled before it was last redriven.
+func previousAttempts(meta ensign.Metadata) int {
+	attempts, _ := strconv.Atoi(meta[dlqAttempts])
+	return attempts
+}
+
+// Publish the event to the dead-letter topic and wait for it to be acked. Returns
+// ErrNoDeadLetter if no dead-letter topic is configured.
+func (s *Subscriber) deadLetter(event *ensign.Event, reason string, cause error, attempts int) (err error) {
+	topic := s.conf.DeadLetter.Topic
+	if topic == "" {
+		return ErrNoDeadLetter
+	}
+
+	letter := newDeadLetterEvent(event, s.conf.Topic, reason, cause, attempts)
+	if err = s.ensign.Publish(topic, letter); err != nil {
+		return fmt.Errorf("could not publish dead letter: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterTimeout)
+	defer cancel()
+	if err = waitForAck(ctx, letter); err != nil {
+		return fmt.Errorf("dead letter was not acked: %w", err)
+	}
+
+	log.Warn().Err(cause).Str("reason", reason).Int("attempts", attempts).Str("id", event.ID()).Str("dead_letter_topic", topic).Msg("event dead-lettered")
+	return nil
+}
+
+// Dead-letter an event that could not be handled, if a dead-letter topic is configured,
+// then nack the event with the specified code.
+func (s *Subscriber) reject(event *ensign.Event, code api.Nack_Code, reason string, cause error) error {
+	log.Debug().Err(cause).Str("reason", reason).Str("id", event.ID()).Msg("could not handle event")
+	if s.conf.DeadLetter.Topic != "" {
+		if err := s.deadLetter(event, reason, cause, previousAttempts(event.Metadata)+1); err != nil {
+			log.Error().Err(err).Str("reason", reason).Str("id", event.ID()).Msg("could not dead-letter event")
+		}
+	}
+
+	if _, err := event.Nack(code); err != nil {
+		return fmt.Errorf("could not nack event: %w", err)
+	}
+	return nil
+}
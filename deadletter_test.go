@@ -0,0 +1,160 @@
+package noaalert_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	sdk "github.com/rotationalio/go-ensign"
+	api "github.com/rotationalio/go-ensign/api/v1beta1"
+	ensignmock "github.com/rotationalio/go-ensign/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetter(t *testing.T) {
+	e := ensignSubscriber(t, noaalert.Config{
+		Subscriber: noaalert.SubscriberConfig{ManualAck: true},
+		DeadLetter: noaalert.DeadLetterConfig{Topic: "noaa-alerts-dlq", MaxAttempts: 2},
+	})
+
+	// An event with an unknown type, an alert that cannot be parsed, and an alert that
+	// the callback fails to handle should all be dead-lettered.
+	e.handler.Send <- ensignmock.NewEventWrapper()
+
+	unparseable := ensignmock.NewEventWrapper()
+	unparseable.Wrap(&api.Event{Type: noaalert.AlertIssuedType, Mimetype: noaalert.Mimetype, Data: []byte("not json")})
+	e.handler.Send <- unparseable
+
+	failing := alertEvent(t, &noaalert.Alert{ID: "fail"})
+	e.send(failing)
+	e.send(alertEvent(t, &noaalert.Alert{ID: "stop"}))
+
+	var attempts int32
+	stop := errors.New("stop")
+	err := e.sub.Run(func(event *noaalert.AlertEvent) error {
+		alert, err := event.Alert()
+		require.NoError(t, err)
+
+		if alert.ID == "stop" {
+			// Nacking the alert stops it from being retried and dead-lettered.
+			event.Nack(noaalert.NackUnprocessed)
+			return stop
+		}
+
+		atomic.AddInt32(&attempts, 1)
+		return errors.New("could not handle alert")
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+
+	expected := []string{api.Nack_UNKNOWN_TYPE.String(), api.Nack_UNPROCESSED.String(), "ack", api.Nack_UNPROCESSED.String()}
+	for _, reply := range expected {
+		require.Equal(t, reply, <-e.replies)
+	}
+
+	letters := make([]*noaalert.DeadLetter, 0, 3)
+	for _, reason := range []string{noaalert.DeadLetterUnknownType, noaalert.DeadLetterUnparseable, noaalert.DeadLetterHandlerFailed} {
+		var event *api.Event
+		select {
+		case event = <-e.published:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s dead letter", reason)
+		}
+		require.Equal(t, noaalert.DeadLetterType.Name, event.Type.Name)
+
+		letter, err := noaalert.ParseDeadLetter(&noaalert.AlertEvent{Type: event.Type, Metadata: event.Metadata, Data: event.Data})
+		require.NoError(t, err)
+		require.Equal(t, reason, letter.Reason)
+		require.Equal(t, "noaa-alerts", letter.Topic)
+		letters = append(letters, letter)
+	}
+
+	// The dead letter of the failed alert contains the original event
+	letter := letters[2]
+	require.Equal(t, 2, letter.Attempts)
+	require.Equal(t, "could not handle alert", letter.Error)
+	require.Equal(t, noaalert.AlertIssuedType.Name, letter.Event.Type.Name)
+	require.Equal(t, noaalert.Mimetype, letter.Event.Mimetype)
+	require.Equal(t, failing.Event().Data, letter.Event.Data)
+	for key := range letter.Event.Metadata {
+		require.NotContains(t, key, "dlq_")
+	}
+
+	// Redriving the dead letter publishes the original event with its attempt count
+	client, err := sdk.New(sdk.WithMock(e.srv))
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, noaalert.Redrive(client, "noaa-alerts", letter))
+	redriven := <-e.published
+	require.Equal(t, noaalert.AlertIssuedType.Name, redriven.Type.Name)
+	require.Equal(t, "2", redriven.Metadata["dlq_attempts"])
+	require.Equal(t, letter.Event.Data, redriven.Data)
+
+	_, err = noaalert.ParseDeadLetter(alertEvent(t, &noaalert.Alert{ID: "alert"}))
+	require.ErrorIs(t, err, noaalert.ErrNotDeadLetter)
+}
+
+func TestDeadLetterTimeout(t *testing.T) {
+	e := ensignSubscriber(t, noaalert.Config{
+		Subscriber: noaalert.SubscriberConfig{ManualAck: true, Timeout: 20 * time.Millisecond},
+		DeadLetter: noaalert.DeadLetterConfig{Topic: "noaa-alerts-dlq", MaxAttempts: 3, Backoff: 10 * time.Millisecond},
+	})
+	e.send(alertEvent(t, &noaalert.Alert{ID: "slow"}))
+	e.send(alertEvent(t, &noaalert.Alert{ID: "stop"}))
+
+	var attempts, running int32
+	var mu sync.Mutex
+	contexts := make(map[context.Context]struct{})
+	stop := errors.New("stop")
+
+	err := e.sub.Run(func(event *noaalert.AlertEvent) error {
+		alert, err := event.Alert()
+		require.NoError(t, err)
+
+		if alert.ID == "stop" {
+			event.Nack(noaalert.NackUnprocessed)
+			return stop
+		}
+
+		// Attempts are never run at the same time and each has its own context.
+		require.Equal(t, int32(1), atomic.AddInt32(&running, 1))
+		defer atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&attempts, 1)
+
+		ctx := event.Context()
+		mu.Lock()
+		contexts[ctx] = struct{}{}
+		mu.Unlock()
+
+		// Keep using the context after the timeout as a slow callback would.
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return event.Context().Err()
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	require.Len(t, contexts, 3)
+
+	var event *api.Event
+	select {
+	case event = <-e.published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for timeout dead letter")
+	}
+
+	letter, err := noaalert.ParseDeadLetter(&noaalert.AlertEvent{Type: event.Type, Metadata: event.Metadata, Data: event.Data})
+	require.NoError(t, err)
+	require.Equal(t, noaalert.DeadLetterTimeout, letter.Reason)
+	require.Equal(t, 3, letter.Attempts)
+	require.Contains(t, letter.Error, noaalert.ErrCallbackTimeout.Error())
+
+	// The dead-lettered alert is acked and the stopped alert is nacked by the callback.
+	for _, reply := range []string{"ack", api.Nack_UNPROCESSED.String()} {
+		require.Equal(t, reply, <-e.replies)
+	}
+}
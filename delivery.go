@@ -0,0 +1,259 @@
+package noaalert
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	sdk "github.com/rotationalio/go-ensign"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of permanently failed deliveries kept for the failure report.
+const maxFailures = 256
+
+// Interval to check the publisher reply stream for acks and nacks.
+const ackPollInterval = 25 * time.Millisecond
+
+// PublishStats counts the outcomes of publishing alerts, summed across all sinks.
+type PublishStats struct {
+	Published uint64 // Number of events sent to sinks including retries
+	Acked     uint64 // Number of events acked by sinks
+	Nacked    uint64 // Number of events nacked by sinks or that timed out waiting
+	Retried   uint64 // Number of events that were republished after a failure
+	Dropped   uint64 // Number of alerts that could not be published after all retries
+}
+
+func (s *PublishStats) add(o PublishStats) {
+	s.Published += o.Published
+	s.Acked += o.Acked
+	s.Nacked += o.Nacked
+	s.Retried += o.Retried
+	s.Dropped += o.Dropped
+}
+
+// Failure records an alert that was dropped after it could not be published.
+type Failure struct {
+	Sink     string
+	AlertID  string
+	Attempts int
+	Err      error
+	Failed   time.Time
+}
+
+// Stats returns the publish counters from the most recent interval tick.
+func (p *Publisher) Stats() PublishStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.stats
+}
+
+// TotalStats returns the publish counters accumulated since the publisher started.
+func (p *Publisher) TotalStats() PublishStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.totals
+}
+
+// Failures returns the most recent alerts that were dropped after all retries.
+func (p *Publisher) Failures() []Failure {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	failures := make([]Failure, len(p.failures))
+	copy(failures, p.failures)
+	return failures
+}
+
+type delivery struct {
+	alert    *AlertEvent
+	receipt  Receipt
+	attempts int
+	err      error
+}
+
+// Publish the alerts to every sink and wait for them to be acked. Each sink has its
+// own delivery loop so that a slow or failing sink does not hold back the others.
+// Alerts are only marked as published in the store once they have been acked by every
+// sink, so an alert dropped by one sink is sent to all sinks again on the next tick.
+// If the context is cancelled, e.g. on shutdown, alerts are no longer retried.
+func (p *Publisher) publish(ctx context.Context, alerts []*AlertEvent) (stats PublishStats) {
+	if p.conf.EnrichGeometry {
+		p.enrichAll(alerts)
+	}
+
+	// Decode the alerts before the sinks read them concurrently.
+	for _, alert := range alerts {
+		alert.Alert()
+		p.attachDiff(alert)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]PublishStats, len(p.sinks))
+	acks := make([]map[*AlertEvent]struct{}, len(p.sinks))
+	for i, sink := range p.sinks {
+		wg.Add(1)
+		go func(i int, sink Sink) {
+			defer wg.Done()
+			results[i], acks[i] = p.deliver(ctx, sink, alerts)
+		}(i, sink)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		stats.add(result)
+	}
+
+alerts:
+	for _, alert := range alerts {
+		for _, acked := range acks {
+			if _, ok := acked[alert]; !ok {
+				continue alerts
+			}
+		}
+
+		if err := p.markPublished(alert); err != nil {
+			log.Warn().Err(err).Msg("could not mark weather alert as published")
+		}
+	}
+	return stats
+}
+
+// Deliver the alerts to the sink and wait for them to be acked. Alerts that are
+// nacked, time out, or that cannot be sent are retried with exponential backoff; if
+// they still fail after all retries they are dropped and recorded in the failure
+// report. The alerts that were acked by the sink are returned.
+func (p *Publisher) deliver(ctx context.Context, sink Sink, alerts []*AlertEvent) (stats PublishStats, acked map[*AlertEvent]struct{}) {
+	acked = make(map[*AlertEvent]struct{}, len(alerts))
+	pending := make([]*delivery, 0, len(alerts))
+	for _, alert := range alerts {
+		pending = append(pending, &delivery{alert: alert})
+	}
+
+	backoff := p.conf.PublishBackoff
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > p.conf.PublishRetries {
+				p.dropAll(sink, pending)
+				stats.Dropped += uint64(len(pending))
+				break
+			}
+
+			log.Debug().Str("sink", sink.Name()).Int("attempt", attempt).Int("pending", len(pending)).Dur("backoff", backoff).Msg("retrying failed weather alerts")
+			if err := sleep(ctx, backoff); err != nil {
+				for _, d := range pending {
+					d.err = err
+				}
+				p.dropAll(sink, pending)
+				stats.Dropped += uint64(len(pending))
+				break
+			}
+			backoff *= 2
+			stats.Retried += uint64(len(pending))
+		}
+
+		// Send all pending events before waiting for acks so that acks are collected
+		// while the remaining events are in flight.
+		failed := make([]*delivery, 0)
+		inflight := make([]*delivery, 0, len(pending))
+		for _, d := range pending {
+			d.attempts++
+			if d.receipt, d.err = sink.Publish(d.alert); d.err != nil {
+				log.Debug().Err(d.err).Str("sink", sink.Name()).Msg("could not publish weather alert")
+				failed = append(failed, d)
+				continue
+			}
+
+			stats.Published++
+			inflight = append(inflight, d)
+		}
+
+		// Acks are collected even if the context is cancelled so that the alerts that
+		// were sent before a shutdown are recorded as published.
+		actx, cancel := context.WithTimeout(context.Background(), p.conf.AckTimeout)
+		for _, d := range inflight {
+			if d.err = d.receipt.Wait(actx); d.err != nil {
+				log.Debug().Err(d.err).Str("sink", sink.Name()).Msg("weather alert was not acked")
+				stats.Nacked++
+				failed = append(failed, d)
+				continue
+			}
+
+			stats.Acked++
+			acked[d.alert] = struct{}{}
+		}
+		cancel()
+
+		pending = failed
+	}
+
+	return stats, acked
+}
+
+// Record the permanently failed deliveries in the failure report.
+func (p *Publisher) dropAll(sink Sink, pending []*delivery) {
+	for _, d := range pending {
+		p.dropped(sink, d)
+	}
+}
+
+// Record a permanently failed delivery in the failure report.
+func (p *Publisher) dropped(sink Sink, d *delivery) {
+	failure := Failure{Sink: sink.Name(), Attempts: d.attempts, Err: d.err, Failed: time.Now()}
+	if alert, err := d.alert.Alert(); err == nil {
+		failure.AlertID = alert.ID
+	}
+
+	log.Error().Err(failure.Err).Str("sink", failure.Sink).Str("alert_id", failure.AlertID).Int("attempts", failure.Attempts).Msg("dropped weather alert")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures = append(p.failures, failure)
+	if len(p.failures) > maxFailures {
+		p.failures = p.failures[len(p.failures)-maxFailures:]
+	}
+}
+
+// Record the stats of the most recent interval tick.
+func (p *Publisher) record(stats PublishStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats = stats
+	p.totals.add(stats)
+}
+
+// Wait for the event to be acked or nacked by Ensign or for the context to be done.
+func waitForAck(ctx context.Context, event *sdk.Event) error {
+	ticker := time.NewTicker(ackPollInterval)
+	defer ticker.Stop()
+
+	for {
+		acked, aerr := event.Acked()
+		if acked {
+			return nil
+		}
+
+		nacked, nerr := event.Nacked()
+		if nacked {
+			if nerr != nil {
+				return fmt.Errorf("%w: %s", ErrNacked, nerr)
+			}
+			return ErrNacked
+		}
+
+		if aerr != nil {
+			return aerr
+		}
+
+		if nerr != nil {
+			return nerr
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrAckTimeout
+		case <-ticker.C:
+		}
+	}
+}
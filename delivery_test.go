@@ -0,0 +1,99 @@
+package noaalert_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/bbengfort/noaalert/mock"
+	"github.com/oklog/ulid/v2"
+	sdk "github.com/rotationalio/go-ensign"
+	api "github.com/rotationalio/go-ensign/api/v1beta1"
+	ensignmock "github.com/rotationalio/go-ensign/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDeliver(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	acked := nws.Issue(&noaalert.Alert{Event: "Flood Warning"})
+	retried := nws.Issue(&noaalert.Alert{Event: "Heat Advisory"})
+	dropped := nws.Issue(&noaalert.Alert{Event: "Wind Advisory"})
+
+	// The mock acks the first alert, nacks the second alert once, and always nacks the
+	// third alert so that it is dropped after all retries.
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+
+	srv := ensignmock.New(nil)
+	t.Cleanup(func() { go srv.Shutdown() })
+
+	publisher := ensignmock.NewPublishHandler(map[string]ulid.ULID{"noaa-alerts": ulid.Make()})
+	publisher.OnEvent = func(in *api.EventWrapper) (*api.PublisherReply, error) {
+		event, err := in.Unwrap()
+		require.NoError(t, err)
+
+		mu.Lock()
+		id := event.Metadata["alert_id"]
+		attempts[id]++
+		nack := id == dropped.ID || (id == retried.ID && attempts[id] == 1)
+		mu.Unlock()
+
+		if nack {
+			return &api.PublisherReply{Embed: &api.PublisherReply_Nack{Nack: &api.Nack{Id: in.LocalId, Code: api.Nack_UNPROCESSED}}}, nil
+		}
+		return &api.PublisherReply{Embed: &api.PublisherReply_Ack{Ack: &api.Ack{Id: in.LocalId, Committed: timestamppb.Now()}}}, nil
+	}
+	srv.OnPublish = publisher.OnPublish
+
+	conf, err := noaalert.Config{
+		Topic:          "noaa-alerts",
+		Interval:       5 * time.Minute,
+		StorePath:      filepath.Join(t.TempDir(), "alerts.jsonl"),
+		AckTimeout:     5 * time.Second,
+		PublishRetries: 2,
+		PublishBackoff: time.Millisecond,
+		Sinks:          []string{noaalert.SinkStdout},
+		Weather:        noaalert.WeatherConfig{UserAgent: testUserAgent, BaseURL: nws.URL().String()},
+	}.Mark()
+	require.NoError(t, err)
+
+	sink, err := noaalert.NewEnsignSink(conf, sdk.WithMock(srv))
+	require.NoError(t, err)
+
+	pub, err := noaalert.New(conf, sink)
+	require.NoError(t, err)
+	defer pub.Shutdown()
+
+	start := time.Now().Add(-time.Hour)
+	stats, err := pub.Backfill(context.Background(), start, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), stats.Published, "expected three attempts for the dropped alert and two for the retried alert")
+	require.Equal(t, uint64(2), stats.Acked)
+	require.Equal(t, uint64(4), stats.Nacked)
+	require.Equal(t, uint64(3), stats.Retried)
+	require.Equal(t, uint64(1), stats.Dropped)
+
+	mu.Lock()
+	require.Equal(t, 1, attempts[acked.ID])
+	require.Equal(t, 2, attempts[retried.ID])
+	require.Equal(t, 3, attempts[dropped.ID])
+	mu.Unlock()
+
+	failures := pub.Failures()
+	require.Len(t, failures, 1)
+	require.Equal(t, noaalert.SinkEnsign, failures[0].Sink)
+	require.Equal(t, dropped.ID, failures[0].AlertID)
+	require.Equal(t, 3, failures[0].Attempts)
+	require.ErrorIs(t, failures[0].Err, noaalert.ErrNacked)
+
+	// Only the dropped alert is published again
+	stats, err = pub.Backfill(context.Background(), start, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), stats.Published)
+	require.Equal(t, uint64(1), stats.Dropped)
+}
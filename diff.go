@@ -0,0 +1,228 @@
+package noaalert
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// AlertDiff describes what changed between an alert and the previous version of the
+// alert that it updates, i.e. the most recent alert in its references that has been
+// published. The diff is attached to the published event so that subscribers do not
+// have to compare the full text of both alerts.
+type AlertDiff struct {
+	Previous string        `json:"previous"`
+	Changes  []FieldChange `json:"changes"`
+}
+
+// FieldChange is the change to a single alert property. Scalar properties have the old
+// and new values, properties that are lists have the values that were added or removed.
+type FieldChange struct {
+	Field   string   `json:"field"`
+	Old     string   `json:"old,omitempty"`
+	New     string   `json:"new,omitempty"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Diff compares the previous and next versions of an alert field by field.
+func Diff(prev, next *Alert) *AlertDiff {
+	diff := &AlertDiff{Previous: prev.ID, Changes: make([]FieldChange, 0)}
+
+	scalars := []struct {
+		field      string
+		prev, next string
+	}{
+		{"event", prev.Event, next.Event},
+		{"severity", string(prev.Severity), string(next.Severity)},
+		{"urgency", string(prev.Urgency), string(next.Urgency)},
+		{"certainty", string(prev.Certainty), string(next.Certainty)},
+		{"areaDesc", prev.AreaDesc, next.AreaDesc},
+		{"onset", timestamp(prev.Onset), timestamp(next.Onset)},
+		{"expires", timestamp(prev.Expires), timestamp(next.Expires)},
+		{"ends", timestamp(prev.Ends), timestamp(next.Ends)},
+		{"headline", prev.Headline, next.Headline},
+		{"description", prev.Description, next.Description},
+		{"instruction", prev.Instruction, next.Instruction},
+		{"response", prev.Response, next.Response},
+	}
+
+	for _, s := range scalars {
+		if s.prev != s.next {
+			diff.Changes = append(diff.Changes, FieldChange{Field: s.field, Old: s.prev, New: s.next})
+		}
+	}
+
+	if added, removed := setDiff(prev.Geocode.UGC, next.Geocode.UGC); len(added) > 0 || len(removed) > 0 {
+		diff.Changes = append(diff.Changes, FieldChange{Field: "zones", Added: added, Removed: removed})
+	}
+	return diff
+}
+
+// Changed returns the change to the specified field or nil if it did not change.
+func (d *AlertDiff) Changed(field string) *FieldChange {
+	for i := range d.Changes {
+		if d.Changes[i].Field == field {
+			return &d.Changes[i]
+		}
+	}
+	return nil
+}
+
+// Summary returns a short human readable description of the changes, e.g.
+// "severity Moderate→Severe; zones +2 -1; expires extended 3h0m0s".
+func (d *AlertDiff) Summary() string {
+	if len(d.Changes) == 0 {
+		return "no changes"
+	}
+
+	parts := make([]string, 0, len(d.Changes))
+	for _, c := range d.Changes {
+		switch c.Field {
+		case "zones":
+			parts = append(parts, fmt.Sprintf("zones +%d -%d", len(c.Added), len(c.Removed)))
+		case "headline", "description", "instruction", "areaDesc":
+			parts = append(parts, c.Field+" changed")
+		case "onset", "expires", "ends":
+			parts = append(parts, c.Field+" "+shift(c.Old, c.New))
+		default:
+			parts = append(parts, fmt.Sprintf("%s %s→%s", c.Field, c.Old, c.New))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Diff returns the changes from the previous version of the alert that were attached
+// by the publisher, or ErrNoDiff if the alert does not update a published alert.
+func (a *AlertEvent) Diff() (_ *AlertDiff, err error) {
+	data, ok := a.Metadata["diff"]
+	if !ok || data == "" {
+		return nil, ErrNoDiff
+	}
+
+	diff := &AlertDiff{}
+	if err = json.Unmarshal([]byte(data), diff); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// Attach the diff between the alert and the most recent published alert it references
+// to the metadata of the alert event.
+func (p *Publisher) attachDiff(event *AlertEvent) {
+	var (
+		prev  *Record
+		alert *Alert
+		err   error
+	)
+
+	if event.EventType() == AlertExpiredType {
+		return
+	}
+
+	for _, id := range event.Supersedes() {
+		var rec *Record
+		if rec, err = p.store.Get(id); err != nil || len(rec.Alert) == 0 {
+			continue
+		}
+
+		if prev == nil || sentAfter(rec, prev) {
+			prev = rec
+		}
+	}
+
+	if prev == nil {
+		return
+	}
+
+	if alert, err = event.Alert(); err != nil {
+		return
+	}
+
+	previous := &Alert{}
+	if err = json.Unmarshal(prev.Alert, previous); err != nil {
+		log.Debug().Err(err).Str("alert_id", prev.ID).Msg("could not decode previous alert")
+		return
+	}
+
+	diff := Diff(previous, alert)
+	var data []byte
+	if data, err = json.Marshal(diff); err != nil {
+		return
+	}
+
+	if event.Metadata == nil {
+		event.Metadata = make(map[string]string)
+	}
+	event.Metadata["diff"] = string(data)
+	event.Metadata["diff_summary"] = diff.Summary()
+}
+
+// Returns true if the first record was sent after the second.
+func sentAfter(a, b *Record) bool {
+	at, _ := time.Parse(time.RFC3339, a.Sent)
+	bt, _ := time.Parse(time.RFC3339, b.Sent)
+	return at.After(bt)
+}
+
+func timestamp(ts time.Time) string {
+	if ts.IsZero() {
+		return ""
+	}
+	return ts.Format(time.RFC3339)
+}
+
+// Describes how a timestamp moved, e.g. "extended 3h0m0s" or "cleared".
+func shift(prev, next string) string {
+	switch {
+	case prev == "":
+		return "set"
+	case next == "":
+		return "cleared"
+	}
+
+	pts, perr := time.Parse(time.RFC3339, prev)
+	nts, nerr := time.Parse(time.RFC3339, next)
+	if perr != nil || nerr != nil {
+		return "changed"
+	}
+
+	if delta := nts.Sub(pts); delta < 0 {
+		return "shortened " + (-delta).String()
+	}
+	return "extended " + nts.Sub(pts).String()
+}
+
+// Returns the sorted values that were added to and removed from the previous list.
+func setDiff(prev, next []string) (added, removed []string) {
+	pset := make(map[string]struct{}, len(prev))
+	for _, v := range prev {
+		pset[v] = struct{}{}
+	}
+
+	nset := make(map[string]struct{}, len(next))
+	for _, v := range next {
+		if _, ok := nset[v]; ok {
+			continue
+		}
+
+		nset[v] = struct{}{}
+		if _, ok := pset[v]; !ok {
+			added = append(added, v)
+		}
+	}
+
+	for v := range pset {
+		if _, ok := nset[v]; !ok {
+			removed = append(removed, v)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
@@ -0,0 +1,99 @@
+package noaalert_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/bbengfort/noaalert/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	expires := time.Date(2023, 8, 3, 22, 0, 0, 0, time.UTC)
+	prev := &noaalert.Alert{
+		ID:          "alert-1",
+		Event:       "Flood Warning",
+		Severity:    noaalert.SeverityModerate,
+		Expires:     expires,
+		Instruction: "Turn around, don't drown.",
+		Geocode:     noaalert.Geocode{UGC: []string{"MAZ005", "MAZ006"}},
+	}
+
+	next := *prev
+	next.ID = "alert-2"
+	next.Severity = noaalert.SeveritySevere
+	next.Expires = expires.Add(3 * time.Hour)
+	next.Geocode.UGC = []string{"MAZ006", "MAZ007", "MAZ008"}
+
+	diff := noaalert.Diff(prev, &next)
+	require.Equal(t, "alert-1", diff.Previous)
+	require.Len(t, diff.Changes, 3)
+	require.Equal(t, &noaalert.FieldChange{Field: "severity", Old: "Moderate", New: "Severe"}, diff.Changed("severity"))
+	require.Equal(t, []string{"MAZ007", "MAZ008"}, diff.Changed("zones").Added)
+	require.Equal(t, []string{"MAZ005"}, diff.Changed("zones").Removed)
+	require.Nil(t, diff.Changed("instruction"))
+	require.Equal(t, "severity Moderate→Severe; expires extended 3h0m0s; zones +2 -1", diff.Summary())
+
+	// Subscribers decode the diff from the event metadata
+	event := &noaalert.AlertEvent{}
+	_, err := event.Diff()
+	require.ErrorIs(t, err, noaalert.ErrNoDiff)
+
+	data, err := json.Marshal(diff)
+	require.NoError(t, err)
+	event.Metadata = map[string]string{"diff": string(data)}
+
+	actual, err := event.Diff()
+	require.NoError(t, err)
+	require.Equal(t, diff, actual)
+}
+
+func TestPublishDiff(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	issued := nws.Issue(&noaalert.Alert{Event: "Flood Warning", Severity: noaalert.SeverityModerate})
+
+	sink := &recordSink{}
+	pub, err := noaalert.New(publisherConfig(t, nws.URL().String()), sink)
+	require.NoError(t, err)
+	defer pub.Shutdown()
+
+	_, err = pub.Publish(context.Background())
+	require.NoError(t, err)
+	events := sink.events()
+	require.Len(t, events, 1)
+	_, err = events[0].Diff()
+	require.ErrorIs(t, err, noaalert.ErrNoDiff, "a new alert should not have a diff")
+
+	// An update is published with the diff from the published alert it references
+	_, err = nws.Update(issued.ID, func(alert *noaalert.Alert) {
+		alert.Severity = noaalert.SeveritySevere
+	})
+	require.NoError(t, err)
+
+	_, err = pub.Publish(context.Background())
+	require.NoError(t, err)
+	events = sink.events()
+	require.Len(t, events, 1)
+
+	diff, err := events[0].Diff()
+	require.NoError(t, err)
+	require.Equal(t, issued.ID, diff.Previous)
+	require.Len(t, diff.Changes, 1)
+	require.Equal(t, &noaalert.FieldChange{Field: "severity", Old: "Moderate", New: "Severe"}, diff.Changed("severity"))
+	require.Equal(t, "severity Moderate→Severe", events[0].Metadata["diff_summary"])
+
+	// An alert that references an alert that was not published has no diff
+	nws.Issue(&noaalert.Alert{Event: "Flood Warning", References: []noaalert.Reference{{Identifier: "unknown"}}})
+	stats, err := pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.Acked)
+
+	events = sink.events()
+	require.Len(t, events, 1)
+	require.NotContains(t, events[0].Metadata, "diff")
+	require.NotContains(t, events[0].Metadata, "diff_summary")
+}
@@ -0,0 +1,64 @@
+package noaalert
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+// SinkDryRun is the name of the sink used in dry-run mode.
+const SinkDryRun = "dry-run"
+
+// DryRunSink logs a summary of each alert event instead of sending it anywhere. It
+// acks every event immediately so that the rest of the publish pipeline, including the
+// per-tick counts, runs exactly as it would against a real sink.
+type DryRunSink struct{}
+
+var _ Sink = &DryRunSink{}
+
+func NewDryRunSink() *DryRunSink {
+	return &DryRunSink{}
+}
+
+func (s *DryRunSink) Name() string {
+	return SinkDryRun
+}
+
+func (s *DryRunSink) Publish(alert *AlertEvent) (Receipt, error) {
+	event := alert.Event()
+	ctx := log.Info().
+		Str("type", event.Type.Name).
+		Interface("metadata", event.Metadata).
+		Int("size", len(event.Data))
+
+	if data, err := alert.Alert(); err == nil {
+		ctx = ctx.Str("alert_id", data.ID).
+			Str("event", data.Event).
+			Str("severity", string(data.Severity)).
+			Str("area", data.AreaDesc).
+			Str("headline", data.Headline)
+	}
+
+	ctx.Msg("dry run: weather alert would be published")
+	return receipt{}, nil
+}
+
+func (s *DryRunSink) Close() error {
+	return nil
+}
+
+// Open a copy of the store for a dry run so that alerts that have already been
+// published are skipped but the durable store on disk is never modified.
+func openDryRunStore(path string) (_ Store, err error) {
+	if path == "" {
+		return NewMemoryStore(), nil
+	}
+
+	store := &FileStore{
+		MemoryStore: MemoryStore{records: make(map[string]*Record)},
+		path:        path,
+	}
+
+	if err = store.load(); err != nil {
+		return nil, err
+	}
+	return &store.MemoryStore, nil
+}
@@ -0,0 +1,61 @@
+package noaalert_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/bbengfort/noaalert/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	published := nws.Issue(&noaalert.Alert{Event: "Flood Warning"})
+	nws.Issue(&noaalert.Alert{Event: "Heat Advisory"})
+
+	// Record one of the alerts as previously published in a durable store
+	path := filepath.Join(t.TempDir(), "alerts.jsonl")
+	store, err := noaalert.OpenFileStore(path)
+	require.NoError(t, err)
+	rec, err := alertEvent(t, published).Record()
+	require.NoError(t, err)
+	require.NoError(t, store.Put(rec))
+	require.NoError(t, store.Close())
+
+	// The ensign sink is configured but no credentials are required for a dry run
+	conf := noaalert.Config{
+		Topic:          "noaa-alerts",
+		Interval:       5 * time.Minute,
+		StorePath:      path,
+		AckTimeout:     time.Second,
+		PublishBackoff: time.Millisecond,
+		Sinks:          []string{noaalert.SinkEnsign},
+		Weather:        noaalert.WeatherConfig{BaseURL: nws.URL().String()},
+	}
+	_, err = conf.Mark()
+	require.ErrorIs(t, err, noaalert.ErrInvalidSink)
+
+	conf.DryRun = true
+	conf, err = conf.Mark()
+	require.NoError(t, err)
+
+	pub, err := noaalert.New(conf)
+	require.NoError(t, err)
+
+	start := time.Now().Add(-time.Hour)
+	stats, err := pub.Backfill(context.Background(), start, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.Published, "previously published alerts should be skipped")
+	require.Equal(t, uint64(1), stats.Acked)
+	require.NoError(t, pub.Shutdown())
+
+	// The durable store should not have been modified by the dry run
+	store, err = noaalert.OpenFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	require.Equal(t, 1, store.Len())
+}
@@ -1,8 +1,87 @@
 package noaalert
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
 
 var (
 	ErrNoProperties = errors.New("parsed alert contains no properties")
 	ErrNoHeadline   = errors.New("parsed alert conains no headline")
+	ErrNoAlertID    = errors.New("parsed alert contains no id")
+	ErrNoDiff       = errors.New("alert does not update a previously published alert")
+	ErrNoGeometry   = errors.New("alert has no geometry")
+	ErrInvalidAlert = errors.New("invalid alert")
+	ErrInvalidQuery = errors.New("invalid alerts query")
+	ErrNotModified  = errors.New("resource has not been modified")
+	ErrNotFound     = errors.New("record not found in store")
+	ErrStoreClosed  = errors.New("store has been closed")
+	ErrNoStorePath  = errors.New("a durable store path is required to skip published alerts")
+	ErrNoUserAgent  = errors.New("a user agent with operator contact information is required to poll the nws")
+	ErrNacked       = errors.New("event was nacked by sink")
+	ErrAckTimeout   = errors.New("timed out waiting for sink to ack event")
+	ErrSinkClosed   = errors.New("sink has been closed")
+
+	ErrSubscriptionClosed = errors.New("subscription was closed by ensign")
+	ErrCallbackTimeout    = errors.New("alert callback timed out")
+	ErrNotSubscribed      = errors.New("alert was not received from a subscription")
+	ErrNoDeadLetter       = errors.New("no dead-letter topic is configured")
+	ErrNotDeadLetter      = errors.New("event is not a dead letter")
+	ErrHandlerPanic       = errors.New("alert handler panicked")
+
+	ErrInvalidInterval = errors.New("invalid configuration: interval must be between the min and max intervals")
+	ErrInvalidJitter   = errors.New("invalid configuration: interval jitter must be in the range [0, 1)")
+	ErrInvalidWeather  = errors.New("invalid weather api configuration")
+	ErrInvalidSink     = errors.New("invalid sink configuration")
+
+	ErrInvalidSubscriber = errors.New("invalid configuration: subscriber workers and timeout cannot be negative")
 )
+
+// APIError is returned when api.weather.gov responds with an error status. The NWS
+// API describes errors with RFC 7807 problem documents; if the response did not include
+// a problem document then the fields are populated from the response status and
+// headers. Use errors.As to inspect the error returned by Weather methods.
+type APIError struct {
+	Type            string           `json:"type"`
+	Title           string           `json:"title"`
+	Status          int              `json:"status"`
+	Detail          string           `json:"detail"`
+	Instance        string           `json:"instance"`
+	CorrelationID   string           `json:"correlationId"`
+	ParameterErrors []ParameterError `json:"parameterErrors,omitempty"`
+}
+
+// ParameterError describes an invalid query parameter in a 400 problem document.
+type ParameterError struct {
+	Parameter string `json:"parameter"`
+	Message   string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("[%d] %s", e.Status, e.Title)
+	if e.Detail != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Detail)
+	}
+	return msg
+}
+
+// RateLimited returns true if the request was rejected because of too many requests.
+func (e *APIError) RateLimited() bool {
+	return e.Status == http.StatusTooManyRequests
+}
+
+// InvalidParameters returns true if the request was rejected because of its parameters.
+func (e *APIError) InvalidParameters() bool {
+	return e.Status == http.StatusBadRequest
+}
+
+// NotFound returns true if the requested resource does not exist.
+func (e *APIError) NotFound() bool {
+	return e.Status == http.StatusNotFound
+}
+
+// Unavailable returns true if the request failed because of an upstream outage.
+func (e *APIError) Unavailable() bool {
+	return e.Status >= http.StatusInternalServerError
+}
@@ -1,7 +1,10 @@
 package noaalert
 
 import (
+	"context"
 	"encoding/json"
+	"strings"
+	"time"
 
 	"github.com/rotationalio/go-ensign"
 	api "github.com/rotationalio/go-ensign/api/v1beta1"
@@ -15,11 +18,20 @@ type AlertEvent struct {
 	LastModified  string
 	Expires       string
 	Data          []byte
+	Metadata      ensign.Metadata
+	Type          *api.Type
+	Sites         []string
+	ctx           context.Context
+	event         *ensign.Event
 	parsed        map[string]interface{}
+	alert         *Alert
+	original      []byte
 }
 
 var Mimetype = mimetype.ApplicationJSON
 
+// AlertType was published for every alert before lifecycle event types were added;
+// subscribers still accept it so that older events on the topic can be consumed.
 var AlertType = &api.Type{
 	Name:         "Alert",
 	MajorVersion: 1,
@@ -27,22 +39,118 @@ var AlertType = &api.Type{
 	PatchVersion: 0,
 }
 
+// Event types for each stage of the lifecycle of an alert chain.
+var (
+	AlertIssuedType    = &api.Type{Name: "AlertIssued", MajorVersion: 1}
+	AlertUpdatedType   = &api.Type{Name: "AlertUpdated", MajorVersion: 1}
+	AlertCancelledType = &api.Type{Name: "AlertCancelled", MajorVersion: 1}
+	AlertExpiredType   = &api.Type{Name: "AlertExpired", MajorVersion: 1}
+)
+
+// Returns true if the event type is one of the alert event types.
+func isAlertType(t *api.Type) bool {
+	if t == nil {
+		return false
+	}
+
+	for _, at := range []*api.Type{AlertType, AlertIssuedType, AlertUpdatedType, AlertCancelledType, AlertExpiredType} {
+		if t.Name == at.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Create an alert event from an event received from Ensign.
+func newAlertEvent(event *ensign.Event) *AlertEvent {
+	return &AlertEvent{
+		CorrelationID: event.Metadata["correlation_id"],
+		RequestID:     event.Metadata["request_id"],
+		ServerID:      event.Metadata["server_id"],
+		LastModified:  event.Metadata["last_modified"],
+		Expires:       event.Metadata["expires"],
+		Data:          event.Data,
+		Metadata:      event.Metadata,
+		Type:          event.Type,
+		event:         event,
+	}
+}
+
 func (a *AlertEvent) Event() *ensign.Event {
 	meta := make(ensign.Metadata)
+	for key, val := range a.Metadata {
+		meta[key] = val
+	}
+
 	meta["correlation_id"] = a.CorrelationID
 	meta["request_id"] = a.RequestID
 	meta["server_id"] = a.ServerID
 	meta["last_modified"] = a.LastModified
 	meta["expires"] = a.Expires
 
+	etype := a.EventType()
+	if alert, err := a.Alert(); err == nil {
+		meta["alert_id"] = alert.ID
+		if supersedes := a.Supersedes(); len(supersedes) > 0 && etype != AlertExpiredType {
+			meta["supersedes"] = strings.Join(supersedes, ",")
+		}
+	}
+
 	return &ensign.Event{
 		Metadata: meta,
 		Data:     a.Data,
-		Type:     AlertType,
+		Type:     etype,
 		Mimetype: Mimetype,
 	}
 }
 
+// EventType returns the lifecycle event type of the alert. If the type was not set
+// when the event was created, it is derived from the CAP message type of the alert.
+func (a *AlertEvent) EventType() *api.Type {
+	if a.Type != nil {
+		return a.Type
+	}
+
+	alert, err := a.Alert()
+	if err != nil {
+		return AlertType
+	}
+
+	switch alert.MessageType {
+	case MessageTypeUpdate:
+		return AlertUpdatedType
+	case MessageTypeCancel:
+		return AlertCancelledType
+	default:
+		return AlertIssuedType
+	}
+}
+
+// Context returns the context of the callback handling the alert; it is cancelled when
+// the callback times out or the subscriber shuts down. Callbacks that make requests
+// should use it so that they stop when the alert is no longer being handled.
+func (a *AlertEvent) Context() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+// Supersedes returns the IDs of the previous alerts in the chain that are updated or
+// cancelled by this alert.
+func (a *AlertEvent) Supersedes() []string {
+	alert, err := a.Alert()
+	if err != nil || len(alert.References) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(alert.References))
+	for _, ref := range alert.References {
+		ids = append(ids, ref.Identifier)
+	}
+	return ids
+}
+
 func (a *AlertEvent) Headline() (_ string, err error) {
 	if err = a.parse(); err != nil {
 		return "", err
@@ -60,6 +168,58 @@ func (a *AlertEvent) Headline() (_ string, err error) {
 	return headline, nil
 }
 
+// Alert decodes the typed alert from the event data. The alert is decoded only once
+// and cached on the event for subsequent calls.
+func (a *AlertEvent) Alert() (_ *Alert, err error) {
+	if a.alert == nil {
+		alert := &Alert{}
+		if err = json.Unmarshal(a.Data, alert); err != nil {
+			return nil, err
+		}
+		a.alert = alert
+	}
+	return a.alert, nil
+}
+
+// Record returns the store record that identifies this version of the alert so that
+// the publisher can detect if the alert has already been published. If the alert was
+// enriched with the geometry of its zones, the record stores the alert as it was
+// received from the NWS rather than the much larger enriched alert.
+func (a *AlertEvent) Record() (_ *Record, err error) {
+	var alert *Alert
+	if alert, err = a.Alert(); err != nil {
+		return nil, err
+	}
+
+	if alert.ID == "" {
+		return nil, ErrNoAlertID
+	}
+
+	now := time.Now()
+	rec := &Record{
+		ID:       alert.ID,
+		Sent:     alert.Sent.Format(time.RFC3339),
+		Expires:  alert.Expires,
+		Ends:     alert.Ends,
+		Seen:     now,
+		Headline: alert.Headline,
+		Alert:    a.Data,
+		Active:   alert.MessageType != MessageTypeCancel && alert.End().After(now),
+	}
+
+	if a.original != nil {
+		rec.Alert = a.original
+	}
+
+	// Updated is not part of the CAP properties but may be included in the feature.
+	if err = a.parse(); err == nil {
+		if props, ok := a.parsed["properties"].(map[string]interface{}); ok {
+			rec.Updated, _ = props["updated"].(string)
+		}
+	}
+	return rec, nil
+}
+
 func (a *AlertEvent) parse() error {
 	if a.parsed == nil {
 		return json.Unmarshal(a.Data, &a.parsed)
@@ -0,0 +1,40 @@
+package noaalert_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventTypes(t *testing.T) {
+	counts := make(map[string]int)
+	for _, feature := range loadFeatures(t) {
+		alert := &noaalert.AlertEvent{Data: feature}
+		event := alert.Event()
+		counts[event.Type.Name]++
+
+		supersedes := alert.Supersedes()
+		if len(supersedes) > 0 {
+			require.NotEqual(t, noaalert.AlertIssuedType, event.Type, "alerts with references should not be issued")
+			require.Equal(t, strings.Join(supersedes, ","), event.Metadata["supersedes"])
+		} else {
+			require.NotContains(t, event.Metadata, "supersedes")
+		}
+		require.NotEmpty(t, event.Metadata["alert_id"])
+	}
+
+	require.Equal(t, 374, counts["AlertIssued"]+counts["AlertUpdated"]+counts["AlertCancelled"])
+	require.NotZero(t, counts["AlertUpdated"])
+
+	// An explicitly set type takes precedence over the message type
+	alert := &noaalert.AlertEvent{Data: []byte(`{"properties":{"id":"alert-1","messageType":"Update"}}`)}
+	require.Equal(t, noaalert.AlertUpdatedType, alert.EventType())
+	alert.Type = noaalert.AlertExpiredType
+	require.Equal(t, noaalert.AlertExpiredType, alert.Event().Type)
+
+	// Events that cannot be decoded keep the original alert type
+	alert = &noaalert.AlertEvent{Data: []byte(`not json`)}
+	require.Equal(t, noaalert.AlertType, alert.EventType())
+}
@@ -0,0 +1,289 @@
+package noaalert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ZoneResolver fetches the geometry of an NWS zone from its URL, e.g. an entry in the
+// affectedZones of an alert. It is used for alerts that do not have a geometry.
+type ZoneResolver interface {
+	ZoneGeometry(ctx context.Context, zoneURL string) (*Geometry, error)
+}
+
+// Position is a GeoJSON position: a longitude, latitude pair.
+type Position [2]float64
+
+// Polygon is a list of linear rings; the first ring is the exterior of the polygon and
+// any remaining rings are holes.
+type Polygon [][]Position
+
+// Site is a location that alerts are filtered by, either a single point or an area.
+type Site struct {
+	ID   string
+	Lat  float64
+	Lon  float64
+	Area []Polygon
+}
+
+// Geofence filters alerts to those whose geometry contains or intersects one or more
+// sites. Alerts that have no geometry are resolved using the geometries of their
+// affected zones if a ZoneResolver is available; otherwise they are not matched.
+type Geofence struct {
+	sites []Site
+	zones ZoneResolver
+}
+
+// Timeout for resolving zone geometries when filtering alerts for a callback.
+const geofenceTimeout = 30 * time.Second
+
+func NewGeofence(sites []Site, zones ZoneResolver) *Geofence {
+	return &Geofence{sites: sites, zones: zones}
+}
+
+// Match returns the IDs of the sites that the alert intersects.
+func (g *Geofence) Match(ctx context.Context, event *AlertEvent) (sites []string, err error) {
+	var alert *Alert
+	if alert, err = event.Alert(); err != nil {
+		return nil, err
+	}
+
+	var polygons []Polygon
+	if alert.Geometry != nil {
+		if polygons, err = alert.Geometry.Polygons(); err != nil {
+			return nil, err
+		}
+	} else {
+		if polygons, err = g.resolve(ctx, alert); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, site := range g.sites {
+		if site.intersects(polygons) {
+			sites = append(sites, site.ID)
+		}
+	}
+	return sites, nil
+}
+
+// Filter wraps a Subscriber callback so that it is only called with the alerts that
+// intersect the geofence. The IDs of the matching sites are attached to the alert.
+// Alerts without a geometry are skipped, but other errors such as failing to fetch a
+// zone are returned so that the alert can be retried or dead-lettered.
+func (g *Geofence) Filter(cb func(*AlertEvent) error) func(*AlertEvent) error {
+	return func(event *AlertEvent) (err error) {
+		ctx, cancel := context.WithTimeout(event.Context(), geofenceTimeout)
+		defer cancel()
+
+		var sites []string
+		if sites, err = g.Match(ctx, event); err != nil {
+			if errors.Is(err, ErrNoGeometry) {
+				log.Debug().Err(err).Msg("alert has no geometry to match to geofence")
+				return nil
+			}
+			return fmt.Errorf("could not match alert to geofence: %w", err)
+		}
+
+		if len(sites) == 0 {
+			return nil
+		}
+
+		event.Sites = sites
+		return cb(event)
+	}
+}
+
+// Middleware returns the geofence filter as a Middleware so that it can be chained.
+func (g *Geofence) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return g.Filter(next)
+	}
+}
+
+// Fetch the geometries of the zones affected by the alert.
+func (g *Geofence) resolve(ctx context.Context, alert *Alert) (polygons []Polygon, err error) {
+	if g.zones == nil || len(alert.AffectedZones) == 0 {
+		return nil, ErrNoGeometry
+	}
+
+	for _, zone := range alert.AffectedZones {
+		var geometry *Geometry
+		if geometry, err = g.zones.ZoneGeometry(ctx, zone); err != nil {
+			return nil, fmt.Errorf("could not resolve zone %s: %w", zone, err)
+		}
+
+		var zpolys []Polygon
+		if zpolys, err = geometry.Polygons(); err != nil {
+			return nil, err
+		}
+		polygons = append(polygons, zpolys...)
+	}
+	return polygons, nil
+}
+
+// LoadSites reads sites from a GeoJSON FeatureCollection of Point, Polygon, or
+// MultiPolygon features. The site ID is the "id" property of the feature, falling back
+// to the feature id.
+func LoadSites(path string) (sites []Site, err error) {
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		return nil, fmt.Errorf("could not read sites: %w", err)
+	}
+
+	collection := struct {
+		Features []struct {
+			ID         string    `json:"id"`
+			Geometry   *Geometry `json:"geometry"`
+			Properties struct {
+				ID string `json:"id"`
+			} `json:"properties"`
+		} `json:"features"`
+	}{}
+
+	if err = json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("could not parse sites: %w", err)
+	}
+
+	sites = make([]Site, 0, len(collection.Features))
+	for i, feature := range collection.Features {
+		site := Site{ID: feature.Properties.ID}
+		if site.ID == "" {
+			site.ID = feature.ID
+		}
+
+		if feature.Geometry == nil {
+			return nil, fmt.Errorf("site %d has no geometry: %w", i, ErrNoGeometry)
+		}
+
+		if feature.Geometry.Type == "Point" {
+			var pos Position
+			if err = json.Unmarshal(feature.Geometry.Coordinates, &pos); err != nil {
+				return nil, fmt.Errorf("could not parse site %d: %w", i, err)
+			}
+			site.Lon, site.Lat = pos[0], pos[1]
+		} else if site.Area, err = feature.Geometry.Polygons(); err != nil {
+			return nil, fmt.Errorf("could not parse site %d: %w", i, err)
+		}
+		sites = append(sites, site)
+	}
+	return sites, nil
+}
+
+// Polygons decodes the coordinates of a Polygon, MultiPolygon, or GeometryCollection.
+func (g *Geometry) Polygons() (polygons []Polygon, err error) {
+	switch g.Type {
+	case "Polygon":
+		var polygon Polygon
+		if err = json.Unmarshal(g.Coordinates, &polygon); err != nil {
+			return nil, err
+		}
+		return []Polygon{polygon}, nil
+	case "MultiPolygon":
+		if err = json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return nil, err
+		}
+		return polygons, nil
+	case "GeometryCollection":
+		for _, geometry := range g.Geometries {
+			var gpolys []Polygon
+			if gpolys, err = geometry.Polygons(); err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, gpolys...)
+		}
+		return polygons, nil
+	default:
+		return nil, fmt.Errorf("%w: unhandled geometry type %q", ErrNoGeometry, g.Type)
+	}
+}
+
+func (s Site) intersects(polygons []Polygon) bool {
+	for _, polygon := range polygons {
+		if len(s.Area) == 0 {
+			if polygon.Contains(Position{s.Lon, s.Lat}) {
+				return true
+			}
+			continue
+		}
+
+		for _, area := range s.Area {
+			if polygon.Intersects(area) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Contains returns true if the position is inside the polygon and not in a hole.
+func (p Polygon) Contains(pos Position) bool {
+	if len(p) == 0 || !inRing(p[0], pos) {
+		return false
+	}
+
+	for _, hole := range p[1:] {
+		if inRing(hole, pos) {
+			return false
+		}
+	}
+	return true
+}
+
+// Intersects returns true if the polygons overlap. Holes are ignored, so a polygon
+// that is entirely within the hole of another is considered to intersect it.
+func (p Polygon) Intersects(o Polygon) bool {
+	if len(p) == 0 || len(o) == 0 {
+		return false
+	}
+
+	for _, pos := range o[0] {
+		if inRing(p[0], pos) {
+			return true
+		}
+	}
+
+	for _, pos := range p[0] {
+		if inRing(o[0], pos) {
+			return true
+		}
+	}
+
+	for i := 0; i+1 < len(p[0]); i++ {
+		for j := 0; j+1 < len(o[0]); j++ {
+			if segmentsIntersect(p[0][i], p[0][i+1], o[0][j], o[0][j+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Ray casting test for a position in a closed linear ring.
+func inRing(ring []Position, pos Position) (inside bool) {
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > pos[1]) != (b[1] > pos[1]) && pos[0] < (b[0]-a[0])*(pos[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func segmentsIntersect(p1, p2, q1, q2 Position) bool {
+	d1 := orientation(q1, q2, p1)
+	d2 := orientation(q1, q2, p2)
+	d3 := orientation(p1, p2, q1)
+	d4 := orientation(p1, p2, q2)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+func orientation(a, b, c Position) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
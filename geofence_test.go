@@ -0,0 +1,112 @@
+package noaalert_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/stretchr/testify/require"
+)
+
+// A square around Boston, MA
+var boston = &noaalert.Geometry{
+	Type:        "Polygon",
+	Coordinates: json.RawMessage(`[[[-71.2,42.2],[-70.9,42.2],[-70.9,42.5],[-71.2,42.5],[-71.2,42.2]]]`),
+}
+
+type zoneResolver map[string]*noaalert.Geometry
+
+func (z zoneResolver) ZoneGeometry(_ context.Context, zoneURL string) (*noaalert.Geometry, error) {
+	if geometry, ok := z[zoneURL]; ok {
+		return geometry, nil
+	}
+	return nil, errors.New("zone not found")
+}
+
+func TestGeofence(t *testing.T) {
+	sites := []noaalert.Site{
+		{ID: "fenway", Lat: 42.3467, Lon: -71.0972},
+		{ID: "worcester", Lat: 42.2626, Lon: -71.8023},
+		{ID: "harbor", Area: []noaalert.Polygon{{{{-71.0, 42.3}, {-70.5, 42.3}, {-70.5, 42.0}, {-71.0, 42.0}, {-71.0, 42.3}}}}},
+	}
+
+	zones := zoneResolver{"https://api.weather.gov/zones/forecast/MAZ015": boston}
+	geofence := noaalert.NewGeofence(sites, zones)
+
+	event := alertEvent(t, &noaalert.Alert{ID: "alert-1", Geometry: boston})
+	matches, err := geofence.Match(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, []string{"fenway", "harbor"}, matches)
+
+	// Alerts without a geometry are resolved from their zones
+	event = alertEvent(t, &noaalert.Alert{ID: "alert-2", AffectedZones: []string{"https://api.weather.gov/zones/forecast/MAZ015"}})
+	matches, err = geofence.Match(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, []string{"fenway", "harbor"}, matches)
+
+	event = alertEvent(t, &noaalert.Alert{ID: "alert-3", AffectedZones: []string{"https://api.weather.gov/zones/forecast/KSZ001"}})
+	_, err = geofence.Match(context.Background(), event)
+	require.Error(t, err)
+
+	event = alertEvent(t, &noaalert.Alert{ID: "alert-4"})
+	_, err = geofence.Match(context.Background(), event)
+	require.ErrorIs(t, err, noaalert.ErrNoGeometry)
+
+	// Only alerts that match are delivered, with the site IDs attached
+	delivered := make([]*noaalert.AlertEvent, 0)
+	filter := geofence.Filter(func(alert *noaalert.AlertEvent) error {
+		delivered = append(delivered, alert)
+		return nil
+	})
+
+	far := &noaalert.Geometry{Type: "MultiPolygon", Coordinates: json.RawMessage(`[[[[-100,38],[-99,38],[-99,39],[-100,39],[-100,38]]]]`)}
+	require.NoError(t, filter(alertEvent(t, &noaalert.Alert{ID: "alert-5", Geometry: far})))
+	require.NoError(t, filter(alertEvent(t, &noaalert.Alert{ID: "alert-6", Geometry: boston})))
+	require.Len(t, delivered, 1)
+	require.Equal(t, []string{"fenway", "harbor"}, delivered[0].Sites)
+
+	// Alerts without a geometry are skipped but zones that cannot be resolved are errors
+	require.NoError(t, filter(alertEvent(t, &noaalert.Alert{ID: "alert-7"})))
+	err = filter(alertEvent(t, &noaalert.Alert{ID: "alert-8", AffectedZones: []string{"https://api.weather.gov/zones/forecast/KSZ001"}}))
+	require.EqualError(t, err, "could not match alert to geofence: could not resolve zone https://api.weather.gov/zones/forecast/KSZ001: zone not found")
+	require.Len(t, delivered, 1)
+}
+
+func TestPolygon(t *testing.T) {
+	polygons, err := boston.Polygons()
+	require.NoError(t, err)
+	require.Len(t, polygons, 1)
+
+	square := polygons[0]
+	require.True(t, square.Contains(noaalert.Position{-71.0, 42.3}))
+	require.False(t, square.Contains(noaalert.Position{-71.3, 42.3}))
+
+	// A polygon with a hole does not contain points in the hole
+	donut := noaalert.Polygon{square[0], {{-71.1, 42.3}, {-71.0, 42.3}, {-71.0, 42.4}, {-71.1, 42.4}, {-71.1, 42.3}}}
+	require.False(t, donut.Contains(noaalert.Position{-71.05, 42.35}))
+	require.True(t, donut.Contains(noaalert.Position{-71.15, 42.25}))
+
+	// Polygons that cross without containing each other's vertices intersect
+	cross := noaalert.Polygon{{{-71.3, 42.3}, {-70.8, 42.3}, {-70.8, 42.4}, {-71.3, 42.4}, {-71.3, 42.3}}}
+	require.True(t, square.Intersects(cross))
+	require.False(t, square.Intersects(noaalert.Polygon{{{-72, 43}, {-71.9, 43}, {-71.9, 43.1}, {-72, 43}}}))
+}
+
+func TestLoadSites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sites.geojson")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type":"FeatureCollection","features":[
+		{"type":"Feature","geometry":{"type":"Point","coordinates":[-71.0972,42.3467]},"properties":{"id":"fenway"}},
+		{"type":"Feature","id":"downtown","geometry":{"type":"Polygon","coordinates":[[[-71.1,42.3],[-71.0,42.3],[-71.0,42.4],[-71.1,42.3]]]},"properties":{}}
+	]}`), 0644))
+
+	sites, err := noaalert.LoadSites(path)
+	require.NoError(t, err)
+	require.Len(t, sites, 2)
+	require.Equal(t, noaalert.Site{ID: "fenway", Lat: 42.3467, Lon: -71.0972}, sites[0])
+	require.Equal(t, "downtown", sites[1].ID)
+	require.Len(t, sites[1].Area, 1)
+}
@@ -0,0 +1,128 @@
+package noaalert
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Reasons that an alert expired, included in the metadata of AlertExpired events.
+const (
+	ExpiredReasonEnded   = "ended"
+	ExpiredReasonRemoved = "removed"
+)
+
+// Synthesize an AlertExpired event for an active alert that has ended or that is no
+// longer in the NWS feed. The NWS does not issue a message when an alert expires, so
+// the event data is the last published version of the alert, or a minimal feature
+// describing it if the record does not contain the alert data.
+func newExpiredEvent(rec *Record, reason string) (_ *AlertEvent, err error) {
+	if len(rec.Alert) > 0 {
+		return &AlertEvent{
+			Type:     AlertExpiredType,
+			Metadata: map[string]string{"expired_reason": reason},
+			Data:     rec.Alert,
+		}, nil
+	}
+
+	alert := &Alert{
+		ID:       rec.ID,
+		Expires:  rec.Expires,
+		Ends:     rec.Ends,
+		Headline: rec.Headline,
+	}
+
+	if alert.Sent, err = time.Parse(time.RFC3339, rec.Sent); err != nil {
+		return nil, err
+	}
+
+	event := &AlertEvent{
+		Type:     AlertExpiredType,
+		Metadata: map[string]string{"expired_reason": reason},
+		alert:    alert,
+	}
+
+	if event.Data, err = json.Marshal(alert); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Returns AlertExpired events for the active alerts that have ended or, if the IDs of
+// the alerts currently in the NWS feed are known, that have been removed from the feed.
+// The NWS removes alerts from the feed when they are superseded, so the alerts that are
+// superseded by alerts being published are skipped; they are deactivated once the
+// alerts that supersede them are published rather than expired.
+func (p *Publisher) expirations(current, superseded map[string]struct{}) []*AlertEvent {
+	records, err := p.store.Active()
+	if err != nil {
+		log.Warn().Err(err).Msg("could not fetch active alerts from store")
+		return nil
+	}
+
+	now := time.Now()
+	events := make([]*AlertEvent, 0)
+	for _, rec := range records {
+		if _, ok := superseded[rec.ID]; ok {
+			continue
+		}
+
+		var reason string
+		if !rec.End().After(now) {
+			reason = ExpiredReasonEnded
+		} else if _, ok := current[rec.ID]; current != nil && !ok {
+			reason = ExpiredReasonRemoved
+		} else {
+			continue
+		}
+
+		event, err := newExpiredEvent(rec, reason)
+		if err != nil {
+			log.Warn().Err(err).Str("alert_id", rec.ID).Msg("could not create expired alert event")
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if len(events) > 0 {
+		log.Debug().Int("expired", len(events)).Msg("active alerts expired")
+	}
+	return events
+}
+
+// Returns the IDs of the alerts that are superseded by the alerts.
+func superseded(alerts []*AlertEvent) map[string]struct{} {
+	ids := make(map[string]struct{})
+	for _, alert := range alerts {
+		for _, id := range alert.Supersedes() {
+			ids[id] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// Mark the records of the specified alerts as no longer active.
+func (p *Publisher) deactivate(ids ...string) (err error) {
+	for _, id := range ids {
+		var rec *Record
+		if rec, err = p.store.Get(id); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return err
+		}
+
+		if !rec.Active {
+			continue
+		}
+
+		inactive := *rec
+		inactive.Active = false
+		if err = p.store.Put(&inactive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package noaalert
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpirations(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	pub := &Publisher{store: NewMemoryStore()}
+
+	records := []*Record{
+		lifecycleRecord(t, "present", now.Add(time.Hour), time.Time{}, true),
+		lifecycleRecord(t, "removed", now.Add(time.Hour), time.Time{}, true),
+		lifecycleRecord(t, "expired", now.Add(-time.Minute), time.Time{}, true),
+		lifecycleRecord(t, "ended", now.Add(time.Hour), now.Add(-time.Minute), true),
+		lifecycleRecord(t, "inactive", now.Add(-time.Minute), time.Time{}, false),
+	}
+
+	// A record without the alert data is expired with a minimal feature
+	records[1].Alert = nil
+	for _, rec := range records {
+		require.NoError(t, pub.store.Put(rec))
+	}
+
+	reasons := func(events []*AlertEvent) map[string]string {
+		out := make(map[string]string, len(events))
+		for _, event := range events {
+			require.Equal(t, AlertExpiredType, event.EventType())
+			alert, err := event.Alert()
+			require.NoError(t, err)
+			out[alert.ID] = event.Metadata["expired_reason"]
+		}
+		return out
+	}
+
+	// Alerts that ended or expired, or that are no longer in the feed, are expired
+	current := map[string]struct{}{"present": {}, "expired": {}, "ended": {}}
+	events := pub.expirations(current, nil)
+	expected := map[string]string{"removed": ExpiredReasonRemoved, "expired": ExpiredReasonEnded, "ended": ExpiredReasonEnded}
+	require.Equal(t, expected, reasons(events))
+
+	for _, event := range events {
+		alert, err := event.Alert()
+		require.NoError(t, err)
+		if alert.ID == "removed" {
+			require.Equal(t, "removed alert", alert.Headline)
+			require.Equal(t, now.Add(time.Hour).Unix(), alert.Expires.Unix())
+		}
+	}
+
+	// If the feed was not modified, only alerts that ended or expired are expired
+	events = pub.expirations(nil, nil)
+	expected = map[string]string{"expired": ExpiredReasonEnded, "ended": ExpiredReasonEnded}
+	require.Equal(t, expected, reasons(events))
+
+	// Publishing the expirations deactivates the records so they do not expire again
+	for _, event := range events {
+		require.NoError(t, pub.markPublished(event))
+	}
+	require.Empty(t, pub.expirations(nil, nil))
+	require.Len(t, pub.expirations(map[string]struct{}{}, nil), 2)
+
+	// Alerts that are superseded by the alerts being published are not expired
+	require.Len(t, pub.expirations(map[string]struct{}{}, map[string]struct{}{"present": {}}), 1)
+}
+
+func TestDeactivateSuperseded(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	pub := &Publisher{store: NewMemoryStore()}
+
+	original := lifecycleRecord(t, "original", now.Add(time.Hour), time.Time{}, true)
+	require.NoError(t, pub.store.Put(original))
+
+	// An update supersedes the original and is itself active
+	update := &Alert{
+		ID:          "update",
+		Sent:        now,
+		Expires:     now.Add(2 * time.Hour),
+		MessageType: MessageTypeUpdate,
+		References:  []Reference{{Identifier: "original"}, {Identifier: "unknown"}},
+	}
+	require.NoError(t, pub.markPublished(lifecycleEvent(t, update)))
+
+	rec, err := pub.store.Get("original")
+	require.NoError(t, err)
+	require.False(t, rec.Active, "superseded alert should be deactivated")
+	require.Equal(t, original.Version(), rec.Version(), "deactivating should not change the version")
+	require.True(t, original.Active, "the stored record should not be modified in place")
+
+	rec, err = pub.store.Get("update")
+	require.NoError(t, err)
+	require.True(t, rec.Active)
+
+	// A cancellation supersedes the update but is not active itself
+	cancel := &Alert{
+		ID:          "cancel",
+		Sent:        now.Add(time.Minute),
+		Expires:     now.Add(time.Hour),
+		MessageType: MessageTypeCancel,
+		References:  []Reference{{Identifier: "original"}, {Identifier: "update"}},
+	}
+	require.NoError(t, pub.markPublished(lifecycleEvent(t, cancel)))
+
+	active, err := pub.store.Active()
+	require.NoError(t, err)
+	require.Empty(t, active)
+}
+
+func lifecycleRecord(t *testing.T, id string, expires, ends time.Time, active bool) *Record {
+	rec, err := lifecycleEvent(t, &Alert{
+		ID:       id,
+		Sent:     expires.Add(-2 * time.Hour),
+		Expires:  expires,
+		Ends:     ends,
+		Headline: id + " alert",
+	}).Record()
+	require.NoError(t, err)
+	rec.Active = active
+	return rec
+}
+
+func lifecycleEvent(t *testing.T, alert *Alert) *AlertEvent {
+	data, err := json.Marshal(alert)
+	require.NoError(t, err)
+	return &AlertEvent{Data: data}
+}
@@ -0,0 +1,364 @@
+package noaalert
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Handler handles an alert received by a Subscriber; see Subscriber.Run.
+type Handler func(*AlertEvent) error
+
+// Middleware wraps a Handler to filter, enrich, or observe the alerts it handles.
+type Middleware func(Handler) Handler
+
+// Chain wraps the handler with the middleware so that the alert passes through the
+// middleware in the order they are specified, e.g. the first middleware is outermost.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Recover returns an error wrapping ErrHandlerPanic if the handler panics so that a
+// bad alert does not crash the subscriber.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(alert *AlertEvent) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Error().Str("stack", string(debug.Stack())).Msgf("alert handler panic: %v", r)
+					err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+				}
+			}()
+			return next(alert)
+		}
+	}
+}
+
+// Log logs every alert that is handled at the specified level; alerts that could not
+// be handled are logged as warnings.
+func Log(level zerolog.Level) Middleware {
+	return func(next Handler) Handler {
+		return func(alert *AlertEvent) (err error) {
+			err = next(alert)
+
+			var ctx *zerolog.Event
+			if err != nil {
+				ctx = log.Warn().Err(err)
+			} else {
+				ctx = log.WithLevel(level)
+			}
+
+			if alert.Type != nil {
+				ctx = ctx.Str("type", alert.Type.Name)
+			}
+			if data, perr := alert.Alert(); perr == nil {
+				ctx = ctx.Str("alert_id", data.ID).Str("event", data.Event)
+			}
+
+			ctx.Msg("alert handled")
+			return err
+		}
+	}
+}
+
+// Timing calls observe with the duration and result of the handler for every alert,
+// e.g. to record metrics. If observe is nil the duration is logged at debug level.
+func Timing(observe func(alert *AlertEvent, took time.Duration, err error)) Middleware {
+	if observe == nil {
+		observe = func(_ *AlertEvent, took time.Duration, err error) {
+			log.Debug().Err(err).Dur("took", took).Msg("alert handler timing")
+		}
+	}
+
+	return func(next Handler) Handler {
+		return func(alert *AlertEvent) (err error) {
+			start := time.Now()
+			err = next(alert)
+			observe(alert, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// Predicate reports whether an alert should be handled.
+type Predicate func(*AlertEvent) bool
+
+// Filter only calls the handler with the alerts that match all of the predicates; the
+// alerts that are filtered out are handled successfully so that they are acked.
+func Filter(predicates ...Predicate) Middleware {
+	return func(next Handler) Handler {
+		return func(alert *AlertEvent) error {
+			for _, match := range predicates {
+				if !match(alert) {
+					return nil
+				}
+			}
+			return next(alert)
+		}
+	}
+}
+
+// InState matches alerts that affect a zone in one of the states or marine areas,
+// specified by their two letter code, e.g. "MD" or "AN".
+func InState(states ...string) Predicate {
+	return func(alert *AlertEvent) bool {
+		data, err := alert.Alert()
+		if err != nil {
+			return false
+		}
+
+		for _, ugc := range data.Geocode.UGC {
+			for _, state := range states {
+				if len(ugc) >= 2 && strings.EqualFold(ugc[:2], state) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// IsActual matches alerts that are actual, dropping test, exercise, system, and draft
+// messages.
+func IsActual() Predicate {
+	return func(alert *AlertEvent) bool {
+		data, err := alert.Alert()
+		return err == nil && data.Status == StatusActual
+	}
+}
+
+// HasSeverity matches alerts with one of the severities.
+func HasSeverity(severities ...Severity) Predicate {
+	return func(alert *AlertEvent) bool {
+		data, err := alert.Alert()
+		if err != nil {
+			return false
+		}
+
+		for _, severity := range severities {
+			if data.Severity == severity {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HasEvent matches alerts for one of the events, e.g. "Tornado Warning".
+func HasEvent(events ...string) Predicate {
+	return func(alert *AlertEvent) bool {
+		data, err := alert.Alert()
+		if err != nil {
+			return false
+		}
+
+		for _, event := range events {
+			if strings.EqualFold(data.Event, event) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Dedupe skips alerts that were already handled successfully within the window, e.g.
+// alerts that are redelivered or redriven. Alerts are identified by their event type,
+// ID, and sent timestamp so that each event in an alert chain is handled. Alerts that
+// cannot be parsed are always handled. A copy of an alert that is still being handled
+// waits for the handler to return and is only handled if the handler failed.
+func Dedupe(window time.Duration) Middleware {
+	d := &deduper{window: window, seen: make(map[string]*dedupeEntry), sweepAt: minDedupeSweep}
+
+	return func(next Handler) Handler {
+		return func(alert *AlertEvent) (err error) {
+			data, perr := alert.Alert()
+			if perr != nil || data.ID == "" {
+				return next(alert)
+			}
+
+			var kind string
+			if alert.Type != nil {
+				kind = alert.Type.Name
+			}
+			key := kind + "|" + data.ID + "|" + data.Sent.Format(time.RFC3339)
+
+			var entry *dedupeEntry
+			if entry, err = d.begin(alert.Context(), key); err != nil {
+				return err
+			}
+
+			if entry == nil {
+				log.Debug().Str("alert_id", data.ID).Str("type", kind).Msg("skipping duplicate alert")
+				return nil
+			}
+
+			err = next(alert)
+			d.finish(key, entry, err == nil)
+			return err
+		}
+	}
+}
+
+// Number of alerts tracked by Dedupe before expired alerts are removed.
+const minDedupeSweep = 1024
+
+// Tracks the alerts handled by Dedupe. Expired alerts are ignored when they are looked
+// up and removed when the number of alerts doubles since the last sweep so that the
+// cost of removing them is amortized across the alerts that are handled.
+type deduper struct {
+	sync.Mutex
+	window  time.Duration
+	seen    map[string]*dedupeEntry
+	sweepAt int
+}
+
+// An alert that is being handled, in which case done is closed when the handler
+// returns, or that was handled successfully at the specified time.
+type dedupeEntry struct {
+	done    chan struct{}
+	handled time.Time
+}
+
+// Mark the alert as being handled and return its entry, or return nil if the alert
+// was already handled within the window. If another copy of the alert is being
+// handled, wait for it to finish first unless the context is cancelled.
+func (d *deduper) begin(ctx context.Context, key string) (*dedupeEntry, error) {
+	for {
+		d.Lock()
+		entry, ok := d.seen[key]
+		if !ok || (entry.done == nil && time.Since(entry.handled) > d.window) {
+			d.sweep()
+			entry = &dedupeEntry{done: make(chan struct{})}
+			d.seen[key] = entry
+			d.Unlock()
+			return entry, nil
+		}
+
+		done := entry.done
+		d.Unlock()
+
+		if done == nil {
+			return nil, nil
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Record the result of handling the alert and release copies of it that are waiting.
+func (d *deduper) finish(key string, entry *dedupeEntry, handled bool) {
+	d.Lock()
+	if handled {
+		entry.handled = time.Now()
+	} else {
+		delete(d.seen, key)
+	}
+
+	done := entry.done
+	entry.done = nil
+	d.Unlock()
+	close(done)
+}
+
+// Remove expired alerts once the number of alerts reaches the sweep threshold; must be
+// called with the lock held.
+func (d *deduper) sweep() {
+	if len(d.seen) < d.sweepAt {
+		return
+	}
+
+	now := time.Now()
+	for key, entry := range d.seen {
+		if entry.done == nil && now.Sub(entry.handled) > d.window {
+			delete(d.seen, key)
+		}
+	}
+
+	d.sweepAt = 2 * len(d.seen)
+	if d.sweepAt < minDedupeSweep {
+		d.sweepAt = minDedupeSweep
+	}
+}
+
+// RateLimit limits the handler to n alerts per interval, allowing bursts of up to n
+// alerts. Alerts wait until they can be handled; if the alert's context is cancelled
+// while waiting then the context error is returned.
+func RateLimit(n int, per time.Duration) Middleware {
+	limiter := newLimiter(n, per)
+	return func(next Handler) Handler {
+		return func(alert *AlertEvent) error {
+			ctx := alert.Context()
+			for {
+				delay := limiter.reserve()
+				if delay <= 0 {
+					return next(alert)
+				}
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+// A token bucket that refills at n tokens per interval up to a burst of n tokens.
+type limiter struct {
+	sync.Mutex
+	tokens float64
+	burst  float64
+	rate   float64 // tokens per nanosecond
+	last   time.Time
+}
+
+func newLimiter(n int, per time.Duration) *limiter {
+	if n < 1 {
+		n = 1
+	}
+	if per <= 0 {
+		per = time.Second
+	}
+
+	return &limiter{
+		tokens: float64(n),
+		burst:  float64(n),
+		rate:   float64(n) / float64(per),
+		last:   time.Now(),
+	}
+}
+
+// Take a token if one is available, otherwise return how long until one is.
+func (l *limiter) reserve() time.Duration {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate)
+}
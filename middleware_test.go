@@ -0,0 +1,194 @@
+package noaalert_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	trace := func(name string) noaalert.Middleware {
+		return func(next noaalert.Handler) noaalert.Handler {
+			return func(alert *noaalert.AlertEvent) error {
+				calls = append(calls, name)
+				return next(alert)
+			}
+		}
+	}
+
+	handler := noaalert.Chain(func(*noaalert.AlertEvent) error {
+		calls = append(calls, "handler")
+		return nil
+	}, trace("first"), trace("second"))
+
+	require.NoError(t, handler(&noaalert.AlertEvent{}))
+	require.Equal(t, []string{"first", "second", "handler"}, calls)
+}
+
+func TestRecover(t *testing.T) {
+	handler := noaalert.Chain(func(*noaalert.AlertEvent) error {
+		panic("bad alert")
+	}, noaalert.Recover(), noaalert.Log(zerolog.DebugLevel))
+
+	err := handler(&noaalert.AlertEvent{})
+	require.ErrorIs(t, err, noaalert.ErrHandlerPanic)
+	require.ErrorContains(t, err, "bad alert")
+}
+
+func TestLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := log.Logger
+	log.Logger = zerolog.New(buf)
+	t.Cleanup(func() { log.Logger = logger })
+
+	failed := errors.New("handler failed")
+	handler := noaalert.Chain(func(alert *noaalert.AlertEvent) error {
+		if data, _ := alert.Alert(); data.ID == "fail" {
+			return failed
+		}
+		return nil
+	}, noaalert.Log(zerolog.InfoLevel))
+
+	// Alerts that could not be handled are logged once as warnings
+	require.NoError(t, handler(alertEvent(t, &noaalert.Alert{ID: "alert"})))
+	require.ErrorIs(t, handler(alertEvent(t, &noaalert.Alert{ID: "fail"})), failed)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"level":"info"`)
+	require.Contains(t, lines[0], `"alert_id":"alert"`)
+	require.Contains(t, lines[1], `"level":"warn"`)
+	require.Contains(t, lines[1], `"alert_id":"fail"`)
+}
+
+func TestTiming(t *testing.T) {
+	var took time.Duration
+	failed := errors.New("handler failed")
+	handler := noaalert.Chain(func(*noaalert.AlertEvent) error {
+		time.Sleep(10 * time.Millisecond)
+		return failed
+	}, noaalert.Timing(func(_ *noaalert.AlertEvent, d time.Duration, err error) {
+		require.ErrorIs(t, err, failed)
+		took = d
+	}))
+
+	require.ErrorIs(t, handler(&noaalert.AlertEvent{}), failed)
+	require.GreaterOrEqual(t, took, 10*time.Millisecond)
+}
+
+func TestFilter(t *testing.T) {
+	var handled []string
+	handler := noaalert.Chain(func(alert *noaalert.AlertEvent) error {
+		data, _ := alert.Alert()
+		handled = append(handled, data.ID)
+		return nil
+	}, noaalert.Filter(noaalert.InState("md", "VA"), noaalert.IsActual()), noaalert.Filter(noaalert.HasSeverity(noaalert.SeveritySevere, noaalert.SeverityExtreme)))
+
+	alerts := []*noaalert.Alert{
+		{ID: "alert-1", Status: noaalert.StatusActual, Severity: noaalert.SeveritySevere, Geocode: noaalert.Geocode{UGC: []string{"MDZ011"}}},
+		{ID: "alert-2", Status: noaalert.StatusTest, Severity: noaalert.SeveritySevere, Geocode: noaalert.Geocode{UGC: []string{"MDZ011"}}},
+		{ID: "alert-3", Status: noaalert.StatusActual, Severity: noaalert.SeveritySevere, Geocode: noaalert.Geocode{UGC: []string{"MAZ005"}}},
+		{ID: "alert-4", Status: noaalert.StatusActual, Severity: noaalert.SeverityMinor, Geocode: noaalert.Geocode{UGC: []string{"VAZ053"}}},
+		{ID: "alert-5", Status: noaalert.StatusActual, Severity: noaalert.SeverityExtreme, Geocode: noaalert.Geocode{UGC: []string{"MAZ005", "VAZ053"}}},
+	}
+
+	for _, alert := range alerts {
+		require.NoError(t, handler(alertEvent(t, alert)))
+	}
+	require.NoError(t, handler(&noaalert.AlertEvent{Data: []byte("not json")}))
+	require.Equal(t, []string{"alert-1", "alert-5"}, handled)
+
+	event := noaalert.HasEvent("tornado warning")
+	require.True(t, event(alertEvent(t, &noaalert.Alert{ID: "alert-6", Event: "Tornado Warning"})))
+	require.False(t, event(alertEvent(t, &noaalert.Alert{ID: "alert-7", Event: "Flood Warning"})))
+}
+
+func TestDedupe(t *testing.T) {
+	calls := 0
+	failed := errors.New("handler failed")
+	handler := noaalert.Chain(func(*noaalert.AlertEvent) error {
+		calls++
+		if calls == 1 {
+			return failed
+		}
+		return nil
+	}, noaalert.Dedupe(time.Hour))
+
+	sent := time.Now().Truncate(time.Second)
+	alert := &noaalert.Alert{ID: "alert-1", Sent: sent}
+
+	// Alerts that failed are not duplicates so that they can be retried
+	require.ErrorIs(t, handler(alertEvent(t, alert)), failed)
+	require.NoError(t, handler(alertEvent(t, alert)))
+	require.NoError(t, handler(alertEvent(t, alert)))
+	require.Equal(t, 2, calls)
+
+	// Other events in the alert chain are not duplicates
+	expired := alertEvent(t, alert)
+	expired.Type = noaalert.AlertExpiredType
+	require.NoError(t, handler(expired))
+
+	alert.Sent = sent.Add(time.Minute)
+	require.NoError(t, handler(alertEvent(t, alert)))
+	require.Equal(t, 4, calls)
+}
+
+func TestDedupeConcurrent(t *testing.T) {
+	var calls int32
+	failed := errors.New("handler failed")
+	release := make(chan struct{})
+	handler := noaalert.Chain(func(*noaalert.AlertEvent) error {
+		// The first copy fails after the other copies are waiting for it
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+			return failed
+		}
+		return nil
+	}, noaalert.Dedupe(time.Hour))
+
+	alert := &noaalert.Alert{ID: "alert-1", Sent: time.Now().Truncate(time.Second)}
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			errs <- handler(alertEvent(t, alert))
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	// The failed copy is retried by one of the waiting copies and the rest are skipped
+	var nfailed int
+	for i := 0; i < 4; i++ {
+		if err := <-errs; err != nil {
+			require.ErrorIs(t, err, failed)
+			nfailed++
+		}
+	}
+	require.Equal(t, 1, nfailed)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestRateLimit(t *testing.T) {
+	calls := 0
+	handler := noaalert.Chain(func(*noaalert.AlertEvent) error {
+		calls++
+		return nil
+	}, noaalert.RateLimit(2, 100*time.Millisecond))
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, handler(&noaalert.AlertEvent{}))
+	}
+	require.Equal(t, 4, calls)
+	require.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
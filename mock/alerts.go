@@ -0,0 +1,319 @@
+package mock
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+)
+
+const (
+	DefaultSender     = "w-nws.webmaster@noaa.gov"
+	DefaultSenderName = "NWS Mock Weather Forecast Office"
+	DefaultDuration   = time.Hour
+)
+
+var ErrUnknownAlert = errors.New("alert has not been issued by the mock server")
+
+//===========================================================================
+// Alert Lifecycle
+//===========================================================================
+
+// Issue publishes a new alert that will be returned by /alerts/active until it expires
+// or is superseded by an update or cancellation. The alert is copied; zero valued
+// fields are populated with defaults and the issued alert is returned.
+func (s *Server) Issue(alert *noaalert.Alert) *noaalert.Alert {
+	s.Lock()
+	defer s.Unlock()
+
+	if alert == nil {
+		alert = &noaalert.Alert{}
+	}
+
+	issued := copyAlert(alert)
+	s.defaults(issued, time.Now().UTC().Truncate(time.Second))
+
+	if issued.MessageType == "" {
+		issued.MessageType = noaalert.MessageTypeAlert
+	}
+
+	s.add(issued)
+	return copyAlert(issued)
+}
+
+// Update issues an alert that supersedes the specified alert. The update copies the
+// previous alert and references it along with all of the alerts it referenced; modify
+// can be used to change fields of the update before it is issued.
+func (s *Server) Update(id string, modify func(*noaalert.Alert)) (*noaalert.Alert, error) {
+	return s.supersede(id, noaalert.MessageTypeUpdate, modify)
+}
+
+// Cancel issues a cancellation of the specified alert. Like the NWS, the cancellation
+// is itself active for a short period so that clients can observe it.
+func (s *Server) Cancel(id string) (*noaalert.Alert, error) {
+	return s.supersede(id, noaalert.MessageTypeCancel, func(alert *noaalert.Alert) {
+		alert.Expires = alert.Sent.Add(10 * time.Minute)
+		alert.Ends = time.Time{}
+		alert.Headline = "The " + alert.Event + " has been cancelled."
+		alert.Description = "The " + alert.Event + " has been cancelled and is no longer in effect."
+		alert.Instruction = ""
+		alert.Response = "AllClear"
+	})
+}
+
+// Expire sets the expiration of the specified alert to the past so that it is no longer
+// returned by /alerts/active, as though time had elapsed on the server.
+func (s *Server) Expire(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	prev, ok := s.index[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAlert, id)
+	}
+
+	// Alerts are replaced rather than modified since they may be encoded concurrently.
+	expired := copyAlert(prev)
+	expired.Expires = time.Now().UTC().Add(-time.Second).Truncate(time.Second)
+	if !expired.Ends.IsZero() && expired.Ends.After(expired.Expires) {
+		expired.Ends = expired.Expires
+	}
+
+	s.index[id] = expired
+	for i, alert := range s.alerts {
+		if alert.ID == id {
+			s.alerts[i] = expired
+		}
+	}
+
+	s.touch()
+	return nil
+}
+
+// Alert returns a copy of the alert with the specified ID.
+func (s *Server) Alert(id string) (*noaalert.Alert, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	alert, ok := s.index[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlert, id)
+	}
+	return copyAlert(alert), nil
+}
+
+// Active returns copies of the alerts currently returned by /alerts/active.
+func (s *Server) Active() []*noaalert.Alert {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := time.Now()
+	alerts := make([]*noaalert.Alert, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		if s.active(alert, now) {
+			alerts = append(alerts, copyAlert(alert))
+		}
+	}
+	return alerts
+}
+
+func (s *Server) supersede(id string, mtype noaalert.MessageType, modify func(*noaalert.Alert)) (*noaalert.Alert, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	prev, ok := s.index[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlert, id)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	next := copyAlert(prev)
+	next.ID, next.URL = "", ""
+	next.MessageType = mtype
+	next.Sent, next.Effective = now, now
+	next.References = append(next.References, noaalert.Reference{
+		URL:        prev.URL,
+		Identifier: prev.ID,
+		Sender:     prev.Sender,
+		Sent:       prev.Sent,
+	})
+
+	if modify != nil {
+		modify(next)
+	}
+
+	s.defaults(next, now)
+	s.add(next)
+	s.superseded[prev.ID] = true
+	return copyAlert(next), nil
+}
+
+// Must be called with the write lock held.
+func (s *Server) add(alert *noaalert.Alert) {
+	s.alerts = append(s.alerts, alert)
+	s.index[alert.ID] = alert
+	s.touch()
+}
+
+// Must be called with the write lock held.
+func (s *Server) touch() {
+	// Last-Modified has a resolution of one second so ensure that it always advances.
+	now := time.Now().UTC().Truncate(time.Second)
+	if !now.After(s.modified) {
+		now = s.modified.Add(time.Second)
+	}
+	s.modified = now
+}
+
+// Populates the zero valued fields of the alert. Must be called with the write lock held.
+func (s *Server) defaults(alert *noaalert.Alert, now time.Time) {
+	if alert.ID == "" {
+		s.seq++
+		sum := sha1.Sum([]byte(strconv.Itoa(s.seq) + now.String()))
+		alert.ID = "urn:oid:2.49.0.1.840.0." + hex.EncodeToString(sum[:]) + ".001.1"
+	}
+
+	if alert.URL == "" {
+		alert.URL = s.srv.URL + "/alerts/" + alert.ID
+	}
+
+	if alert.Sent.IsZero() {
+		alert.Sent = now
+	}
+
+	if alert.Effective.IsZero() {
+		alert.Effective = alert.Sent
+	}
+
+	if alert.Onset.IsZero() {
+		alert.Onset = alert.Effective
+	}
+
+	if alert.Expires.IsZero() {
+		alert.Expires = alert.Sent.Add(DefaultDuration)
+	}
+
+	if alert.Status == "" {
+		alert.Status = noaalert.StatusActual
+	}
+
+	if alert.Category == "" {
+		alert.Category = noaalert.CategoryMet
+	}
+
+	if alert.Severity == "" {
+		alert.Severity = noaalert.SeverityUnknown
+	}
+
+	if alert.Certainty == "" {
+		alert.Certainty = noaalert.CertaintyUnknown
+	}
+
+	if alert.Urgency == "" {
+		alert.Urgency = noaalert.UrgencyUnknown
+	}
+
+	if alert.Event == "" {
+		alert.Event = "Special Weather Statement"
+	}
+
+	if alert.Sender == "" {
+		alert.Sender = DefaultSender
+	}
+
+	if alert.SenderName == "" {
+		alert.SenderName = DefaultSenderName
+	}
+
+	if alert.Headline == "" {
+		alert.Headline = fmt.Sprintf("%s issued %s by %s", alert.Event, alert.Sent.Format("January 2 at 3:04PM MST"), alert.SenderName)
+	}
+}
+
+// Must be called with the read lock held.
+func (s *Server) active(alert *noaalert.Alert, now time.Time) bool {
+	return !s.superseded[alert.ID] && alert.Expires.After(now)
+}
+
+// Returns true if the alert matches the filters in the query. Multiple values for a
+// filter are comma separated and match if any of the values match.
+func match(alert *noaalert.Alert, query url.Values) bool {
+	filters := []struct {
+		param string
+		value string
+	}{
+		{"event", alert.Event},
+		{"severity", string(alert.Severity)},
+		{"urgency", string(alert.Urgency)},
+		{"certainty", string(alert.Certainty)},
+		{"status", string(alert.Status)},
+		{"message_type", string(alert.MessageType)},
+	}
+
+	for _, filter := range filters {
+		if values := split(query.Get(filter.param)); len(values) > 0 && !contains(values, filter.value) {
+			return false
+		}
+	}
+
+	if areas := split(query.Get("area")); len(areas) > 0 {
+		ok := false
+		for _, ugc := range alert.Geocode.UGC {
+			if len(ugc) >= 2 && contains(areas, ugc[:2]) {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	if zones := split(query.Get("zone")); len(zones) > 0 {
+		ok := false
+		for _, ugc := range alert.Geocode.UGC {
+			if contains(zones, ugc) {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func split(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyAlert(alert *noaalert.Alert) *noaalert.Alert {
+	c := *alert
+	c.References = append([]noaalert.Reference(nil), alert.References...)
+	c.AffectedZones = append([]string(nil), alert.AffectedZones...)
+	c.Geocode.UGC = append([]string(nil), alert.Geocode.UGC...)
+	c.Geocode.SAME = append([]string(nil), alert.Geocode.SAME...)
+	return &c
+}
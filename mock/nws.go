@@ -0,0 +1,585 @@
+/*
+Package mock provides an in-process fake of the api.weather.gov alerts API for testing
+code that uses the noaalert Weather client without network access. The fake serves
+the /alerts/active, /alerts, /alerts/{id}, /zones, and /points endpoints, supports
+scripted alert lifecycles, and can inject latency, rate limits, server errors, and
+malformed responses.
+
+	nws := mock.New()
+	defer nws.Close()
+
+	alert := nws.Issue(&noaalert.Alert{Event: "Flood Warning", Severity: noaalert.SeveritySevere})
+	api, _ := nws.Weather()
+	alerts, _ := api.Alerts(ctx, nil)
+*/
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+)
+
+const (
+	geoJSON     = "application/geo+json"
+	problemJSON = "application/problem+json"
+
+	// The maximum age of responses in the Cache-Control header.
+	DefaultMaxAge = 10 * time.Second
+
+	// The default number of alerts per page of the /alerts endpoint.
+	DefaultLimit = 500
+)
+
+// Server is a fake api.weather.gov server. All methods are safe for concurrent use.
+type Server struct {
+	sync.RWMutex
+	srv        *httptest.Server
+	alerts     []*noaalert.Alert
+	index      map[string]*noaalert.Alert
+	superseded map[string]bool
+	zones      map[string]*zone
+	points     map[string]*point
+	modified   time.Time
+	seq        int
+	latency    time.Duration
+	faults     []fault
+	requests   []*http.Request
+	violations []string
+	strict     bool
+}
+
+type zone struct {
+	ztype    string
+	id       string
+	name     string
+	geometry *noaalert.Geometry
+}
+
+type point struct {
+	lat, lon     float64
+	forecastZone string
+	county       string
+	fireZone     string
+}
+
+type fault struct {
+	status    int
+	malformed bool
+}
+
+// New starts a fake NWS server. Requests that do not include the User-Agent and
+// Accept headers set by the noaalert Weather client are rejected.
+func New() *Server {
+	s := &Server{
+		index:      make(map[string]*noaalert.Alert),
+		superseded: make(map[string]bool),
+		zones:      make(map[string]*zone),
+		points:     make(map[string]*point),
+		modified:   time.Now().UTC().Truncate(time.Second),
+		strict:     true,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/alerts/active", s.handle(s.activeAlerts))
+	mux.HandleFunc("/alerts/", s.handle(s.alert))
+	mux.HandleFunc("/alerts", s.handle(s.allAlerts))
+	mux.HandleFunc("/zones/", s.handle(s.zone))
+	mux.HandleFunc("/zones", s.handle(s.listZones))
+	mux.HandleFunc("/points/", s.handle(s.point))
+
+	s.srv = httptest.NewServer(mux)
+	return s
+}
+
+// URL returns the base URL of the fake server.
+func (s *Server) URL() *url.URL {
+	u, _ := url.Parse(s.srv.URL)
+	return u
+}
+
+// Weather returns a Weather client that makes requests to the fake server.
+func (s *Server) Weather(opts ...noaalert.WeatherOption) (api *noaalert.Weather, err error) {
+	if api, err = noaalert.NewWeatherAPI(opts...); err != nil {
+		return nil, err
+	}
+	api.SetBaseURL(s.URL())
+	return api, nil
+}
+
+// Close shuts down the fake server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+//===========================================================================
+// Fault Injection
+//===========================================================================
+
+// SetLatency delays every response by the specified duration.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.Lock()
+	s.latency = latency
+	s.Unlock()
+}
+
+// RateLimit responds to the next n requests with 429 Too Many Requests.
+func (s *Server) RateLimit(n int) {
+	s.Fail(http.StatusTooManyRequests, n)
+}
+
+// Fail responds to the next n requests with the specified error status code.
+func (s *Server) Fail(status, n int) {
+	s.Lock()
+	defer s.Unlock()
+	for i := 0; i < n; i++ {
+		s.faults = append(s.faults, fault{status: status})
+	}
+}
+
+// Malformed responds to the next n requests with a body that is not valid JSON.
+func (s *Server) Malformed(n int) {
+	s.Lock()
+	defer s.Unlock()
+	for i := 0; i < n; i++ {
+		s.faults = append(s.faults, fault{malformed: true})
+	}
+}
+
+// Strict determines if requests without the expected User-Agent and Accept headers
+// are rejected; violations are recorded regardless.
+func (s *Server) Strict(strict bool) {
+	s.Lock()
+	s.strict = strict
+	s.Unlock()
+}
+
+// Requests returns the requests that have been made to the server.
+func (s *Server) Requests() []*http.Request {
+	s.RLock()
+	defer s.RUnlock()
+	requests := make([]*http.Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// Violations returns descriptions of requests that did not have the expected headers.
+func (s *Server) Violations() []string {
+	s.RLock()
+	defer s.RUnlock()
+	violations := make([]string, len(s.violations))
+	copy(violations, s.violations)
+	return violations
+}
+
+// Reset clears all alerts, zones, points, faults, and recorded requests.
+func (s *Server) Reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.alerts = nil
+	s.index = make(map[string]*noaalert.Alert)
+	s.superseded = make(map[string]bool)
+	s.zones = make(map[string]*zone)
+	s.points = make(map[string]*point)
+	s.faults = nil
+	s.requests = nil
+	s.violations = nil
+	s.latency = 0
+	s.touch()
+}
+
+//===========================================================================
+// Zones and Points
+//===========================================================================
+
+// AddZone registers a zone (e.g. type "forecast", id "MAZ007") and its geometry.
+func (s *Server) AddZone(ztype, id, name string, geometry *noaalert.Geometry) string {
+	s.Lock()
+	defer s.Unlock()
+	s.zones[ztype+"/"+id] = &zone{ztype: ztype, id: id, name: name, geometry: geometry}
+	return s.srv.URL + "/zones/" + ztype + "/" + id
+}
+
+// AddPoint registers the zones that contain the point.
+func (s *Server) AddPoint(lat, lon float64, forecastZone, county, fireZone string) {
+	s.Lock()
+	defer s.Unlock()
+	s.points[pointKey(lat, lon)] = &point{lat: lat, lon: lon, forecastZone: forecastZone, county: county, fireZone: fireZone}
+}
+
+func pointKey(lat, lon float64) string {
+	return strconv.FormatFloat(lat, 'f', 4, 64) + "," + strconv.FormatFloat(lon, 'f', 4, 64)
+}
+
+//===========================================================================
+// Handlers
+//===========================================================================
+
+type handler func(w http.ResponseWriter, r *http.Request)
+
+// Wraps an endpoint handler with request recording, header validation, latency, and
+// fault injection.
+func (s *Server) handle(h handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.Lock()
+		s.requests = append(s.requests, r)
+		latency, strict := s.latency, s.strict
+
+		var violation string
+		switch {
+		case r.Header.Get("User-Agent") == "" || strings.HasPrefix(r.Header.Get("User-Agent"), "Go-http-client"):
+			violation = fmt.Sprintf("%s %s: missing User-Agent", r.Method, r.URL.Path)
+		case !strings.Contains(r.Header.Get("Accept"), geoJSON):
+			violation = fmt.Sprintf("%s %s: unexpected Accept %q", r.Method, r.URL.Path, r.Header.Get("Accept"))
+		}
+
+		if violation != "" {
+			s.violations = append(s.violations, violation)
+		}
+
+		var f *fault
+		if len(s.faults) > 0 {
+			f = &s.faults[0]
+			s.faults = s.faults[1:]
+		}
+		s.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if violation != "" && strict {
+			problem(w, http.StatusForbidden, violation)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			problem(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", r.Method))
+			return
+		}
+
+		if f != nil {
+			if f.malformed {
+				w.Header().Set("Content-Type", geoJSON)
+				w.Write([]byte(`{"type":"FeatureCollection","features":[{`))
+				return
+			}
+
+			if f.status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			problem(w, f.status, http.StatusText(f.status))
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+func (s *Server) activeAlerts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if err := checkParams(query, "area", "zone", "point", "region", "region_type", "event", "severity", "urgency", "certainty", "status", "message_type", "code"); err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	s.RLock()
+	modified := s.modified
+	now := time.Now()
+	alerts := make([]*noaalert.Alert, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		if s.active(alert, now) && match(alert, query) {
+			alerts = append(alerts, alert)
+		}
+	}
+	s.RUnlock()
+
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+		cache(w, modified)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	cache(w, modified)
+	collection(w, alerts, "")
+}
+
+func (s *Server) allAlerts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if err := checkParams(query, "area", "zone", "point", "region", "region_type", "event", "severity", "urgency", "certainty", "status", "message_type", "code", "active", "start", "end", "limit", "cursor"); err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	var (
+		err        error
+		start, end time.Time
+		limit      = DefaultLimit
+		cursor     int
+	)
+
+	if v := query.Get("start"); v != "" {
+		if start, err = time.Parse(time.RFC3339, v); err != nil {
+			badRequest(w, &noaalert.ParameterError{Parameter: "start", Message: "Invalid date-time"})
+			return
+		}
+	}
+
+	if v := query.Get("end"); v != "" {
+		if end, err = time.Parse(time.RFC3339, v); err != nil {
+			badRequest(w, &noaalert.ParameterError{Parameter: "end", Message: "Invalid date-time"})
+			return
+		}
+	}
+
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > DefaultLimit {
+			badRequest(w, &noaalert.ParameterError{Parameter: "limit", Message: "Must be between 1 and 500"})
+			return
+		}
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		if cursor, err = strconv.Atoi(v); err != nil || cursor < 0 {
+			badRequest(w, &noaalert.ParameterError{Parameter: "cursor", Message: "Invalid cursor"})
+			return
+		}
+	}
+
+	s.RLock()
+	alerts := make([]*noaalert.Alert, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		if !start.IsZero() && alert.Sent.Before(start) {
+			continue
+		}
+		if !end.IsZero() && alert.Sent.After(end) {
+			continue
+		}
+		if match(alert, query) {
+			alerts = append(alerts, alert)
+		}
+	}
+	s.RUnlock()
+
+	// The NWS returns the most recent alerts first
+	reversed := make([]*noaalert.Alert, 0, len(alerts))
+	for i := len(alerts) - 1; i >= 0; i-- {
+		reversed = append(reversed, alerts[i])
+	}
+
+	page := []*noaalert.Alert{}
+	if cursor < len(reversed) {
+		page = reversed[cursor:]
+		if len(page) > limit {
+			page = page[:limit]
+		}
+	}
+
+	// Like the NWS, a next link is always included even if there are no more results.
+	next := *r.URL
+	next.Scheme, next.Host = "http", r.Host
+	params := next.Query()
+	params.Set("cursor", strconv.Itoa(cursor+len(page)))
+	next.RawQuery = params.Encode()
+
+	collection(w, page, next.String())
+}
+
+func (s *Server) alert(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/alerts/")
+
+	s.RLock()
+	alert, ok := s.index[id]
+	s.RUnlock()
+
+	if !ok {
+		problem(w, http.StatusNotFound, fmt.Sprintf("Alert with identifier %q could not be found", id))
+		return
+	}
+	write(w, http.StatusOK, alert)
+}
+
+func (s *Server) zone(w http.ResponseWriter, r *http.Request) {
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/zones/"), "/")
+
+	s.RLock()
+	z, ok := s.zones[key]
+	s.RUnlock()
+
+	if !ok {
+		problem(w, http.StatusNotFound, fmt.Sprintf("Zone %q could not be found", key))
+		return
+	}
+	write(w, http.StatusOK, s.zoneFeature(z))
+}
+
+func (s *Server) listZones(w http.ResponseWriter, r *http.Request) {
+	ztype := r.URL.Query().Get("type")
+
+	s.RLock()
+	features := make([]interface{}, 0, len(s.zones))
+	for _, z := range s.zones {
+		if ztype == "" || z.ztype == ztype {
+			features = append(features, s.zoneFeature(z))
+		}
+	}
+	s.RUnlock()
+
+	write(w, http.StatusOK, map[string]interface{}{"type": "FeatureCollection", "features": features})
+}
+
+func (s *Server) zoneFeature(z *zone) map[string]interface{} {
+	url := s.srv.URL + "/zones/" + z.ztype + "/" + z.id
+	return map[string]interface{}{
+		"id":       url,
+		"type":     "Feature",
+		"geometry": z.geometry,
+		"properties": map[string]interface{}{
+			"@id":  url,
+			"id":   z.id,
+			"type": z.ztype,
+			"name": z.name,
+		},
+	}
+}
+
+func (s *Server) point(w http.ResponseWriter, r *http.Request) {
+	coords := strings.Split(strings.TrimPrefix(r.URL.Path, "/points/"), ",")
+	if len(coords) != 2 {
+		problem(w, http.StatusNotFound, "Invalid point")
+		return
+	}
+
+	lat, laterr := strconv.ParseFloat(coords[0], 64)
+	lon, lonerr := strconv.ParseFloat(coords[1], 64)
+	if laterr != nil || lonerr != nil {
+		problem(w, http.StatusNotFound, "Invalid point")
+		return
+	}
+
+	s.RLock()
+	p, ok := s.points[pointKey(lat, lon)]
+	s.RUnlock()
+
+	if !ok {
+		problem(w, http.StatusNotFound, fmt.Sprintf("Unable to provide data for requested point %s", pointKey(lat, lon)))
+		return
+	}
+
+	zones := s.srv.URL + "/zones/"
+	write(w, http.StatusOK, map[string]interface{}{
+		"id":   s.srv.URL + "/points/" + pointKey(lat, lon),
+		"type": "Feature",
+		"geometry": map[string]interface{}{
+			"type":        "Point",
+			"coordinates": []float64{lon, lat},
+		},
+		"properties": map[string]interface{}{
+			"forecastZone":    zones + "forecast/" + p.forecastZone,
+			"county":          zones + "county/" + p.county,
+			"fireWeatherZone": zones + "fire/" + p.fireZone,
+		},
+	})
+}
+
+//===========================================================================
+// Response Helpers
+//===========================================================================
+
+func collection(w http.ResponseWriter, alerts []*noaalert.Alert, next string) {
+	features := make([]*noaalert.Alert, len(alerts))
+	copy(features, alerts)
+
+	body := map[string]interface{}{
+		"type":     "FeatureCollection",
+		"title":    "Current watches, warnings, and advisories",
+		"updated":  time.Now().UTC().Format(time.RFC3339),
+		"features": features,
+	}
+
+	if next != "" {
+		body["pagination"] = map[string]string{"next": next}
+	}
+	write(w, http.StatusOK, body)
+}
+
+func cache(w http.ResponseWriter, modified time.Time) {
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(DefaultMaxAge.Seconds())))
+	w.Header().Set("Expires", time.Now().Add(DefaultMaxAge).UTC().Format(http.TimeFormat))
+}
+
+func write(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", geoJSON)
+	w.Header().Set("X-Correlation-Id", correlationID())
+	w.Header().Set("X-Request-Id", correlationID())
+	w.Header().Set("X-Server-Id", "mock-nws")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func problem(w http.ResponseWriter, status int, detail string) {
+	writeProblem(w, &noaalert.APIError{Status: status, Title: http.StatusText(status), Detail: detail})
+}
+
+func badRequest(w http.ResponseWriter, perr *noaalert.ParameterError) {
+	writeProblem(w, &noaalert.APIError{
+		Status:          http.StatusBadRequest,
+		Title:           "Bad Request",
+		Detail:          fmt.Sprintf("Query parameter %q is invalid", perr.Parameter),
+		ParameterErrors: []noaalert.ParameterError{*perr},
+	})
+}
+
+func writeProblem(w http.ResponseWriter, err *noaalert.APIError) {
+	err.CorrelationID = correlationID()
+	err.Type = "https://api.weather.gov/problems/" + strings.ReplaceAll(err.Title, " ", "")
+	err.Instance = "https://api.weather.gov/requests/" + err.CorrelationID
+
+	w.Header().Set("Content-Type", problemJSON)
+	w.Header().Set("X-Correlation-Id", err.CorrelationID)
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(err)
+}
+
+var (
+	cidmu sync.Mutex
+	cid   uint32 = 0x45d6d42e
+)
+
+func correlationID() string {
+	cidmu.Lock()
+	defer cidmu.Unlock()
+	cid++
+	return strconv.FormatUint(uint64(cid), 16)
+}
+
+// Returns an error for the first query parameter that is not allowed.
+func checkParams(query url.Values, allowed ...string) *noaalert.ParameterError {
+	for key := range query {
+		ok := false
+		for _, param := range allowed {
+			if key == param {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return &noaalert.ParameterError{Parameter: key, Message: "Unknown parameter"}
+		}
+	}
+	return nil
+}
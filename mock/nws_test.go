@@ -0,0 +1,126 @@
+package mock_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/bbengfort/noaalert/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycle(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+
+	api, err := nws.Weather()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	flood := nws.Issue(&noaalert.Alert{Event: "Flood Warning", Severity: noaalert.SeveritySevere, Geocode: noaalert.Geocode{UGC: []string{"MAZ007"}}})
+	nws.Issue(&noaalert.Alert{Event: "Heat Advisory", Geocode: noaalert.Geocode{UGC: []string{"KSZ001"}}})
+
+	alerts, err := api.Alerts(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+
+	alerts, err = api.Alerts(ctx, &noaalert.AlertsQuery{Area: []string{"MA"}})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+
+	// The active alerts endpoint does not accept a limit so it is not sent
+	limited, err := api.Alerts(ctx, &noaalert.AlertsQuery{Severity: []string{"severe"}, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, limited, 1)
+
+	alert, err := alerts[0].Alert()
+	require.NoError(t, err)
+	require.Equal(t, flood.ID, alert.ID)
+	require.NoError(t, alert.Validate())
+
+	// Nothing has changed so the conditional request should not return alerts
+	_, err = api.Alerts(ctx, nil)
+	require.ErrorIs(t, err, noaalert.ErrNotModified)
+
+	// An update supersedes the original alert and references it
+	update, err := nws.Update(flood.ID, func(a *noaalert.Alert) { a.Severity = noaalert.SeverityExtreme })
+	require.NoError(t, err)
+	require.Equal(t, noaalert.MessageTypeUpdate, update.MessageType)
+	require.Len(t, update.References, 1)
+	require.Equal(t, flood.ID, update.References[0].Identifier)
+
+	alerts, err = api.Alerts(ctx, &noaalert.AlertsQuery{Severity: []string{"extreme"}})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	alert, _ = alerts[0].Alert()
+	require.Equal(t, update.ID, alert.ID)
+
+	cancel, err := nws.Cancel(update.ID)
+	require.NoError(t, err)
+	require.Len(t, cancel.References, 2)
+	require.Len(t, nws.Active(), 2)
+
+	require.NoError(t, nws.Expire(cancel.ID))
+	require.Len(t, nws.Active(), 1)
+	require.ErrorIs(t, nws.Expire("unknown"), mock.ErrUnknownAlert)
+
+	// All of the alerts are available in the history, most recent first
+	alerts, err = api.History(ctx, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), &noaalert.AlertsQuery{Limit: 2}).All()
+	require.NoError(t, err)
+	require.Len(t, alerts, 4)
+	alert, _ = alerts[0].Alert()
+	require.Equal(t, cancel.ID, alert.ID)
+	require.Empty(t, nws.Violations())
+}
+
+func TestFaults(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+
+	api, err := nws.Weather()
+	require.NoError(t, err)
+	api.SetRetryPolicy(noaalert.NoRetries)
+	ctx := context.Background()
+	nws.Issue(nil)
+
+	target := &noaalert.APIError{}
+	nws.RateLimit(1)
+	_, err = api.Alerts(ctx, nil)
+	require.ErrorAs(t, err, &target)
+	require.True(t, target.RateLimited())
+
+	nws.Fail(http.StatusBadGateway, 1)
+	_, err = api.Alerts(ctx, nil)
+	require.ErrorAs(t, err, &target)
+	require.True(t, target.Unavailable())
+
+	nws.Malformed(1)
+	_, err = api.Alerts(ctx, nil)
+	require.Error(t, err)
+
+	// Faults are consumed so the request should now succeed, even with latency
+	nws.SetLatency(10 * time.Millisecond)
+	alerts, err := api.Alerts(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	require.Len(t, nws.Requests(), 4)
+
+	// Unknown parameters are rejected like the NWS API
+	params := url.Values{"limit": []string{"10"}}
+	req, err := api.NewRequest(ctx, http.MethodGet, "/alerts/active", nil, &params)
+	require.NoError(t, err)
+	_, err = api.Do(req, nil, true)
+	require.ErrorAs(t, err, &target)
+	require.True(t, target.InvalidParameters())
+	require.Equal(t, "limit", target.ParameterErrors[0].Parameter)
+
+	// Requests without the expected headers are rejected
+	rep, err := http.Get(nws.URL().String() + "/alerts/active")
+	require.NoError(t, err)
+	rep.Body.Close()
+	require.Equal(t, http.StatusForbidden, rep.StatusCode)
+	require.Len(t, nws.Violations(), 1)
+}
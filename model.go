@@ -0,0 +1,246 @@
+package noaalert
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Alert is the typed representation of a NWS alert, decoded from the properties of the
+// GeoJSON feature returned by api.weather.gov. The properties are derived from the
+// Common Alerting Protocol (CAP) v1.2 message issued by the NWS.
+type Alert struct {
+	URL           string              `json:"@id,omitempty"`
+	ID            string              `json:"id"`
+	AreaDesc      string              `json:"areaDesc"`
+	Geocode       Geocode             `json:"geocode"`
+	AffectedZones []string            `json:"affectedZones"`
+	References    []Reference         `json:"references"`
+	Sent          time.Time           `json:"sent"`
+	Effective     time.Time           `json:"effective"`
+	Onset         time.Time           `json:"onset"`
+	Expires       time.Time           `json:"expires"`
+	Ends          time.Time           `json:"ends"`
+	Status        Status              `json:"status"`
+	MessageType   MessageType         `json:"messageType"`
+	Category      Category            `json:"category"`
+	Severity      Severity            `json:"severity"`
+	Certainty     Certainty           `json:"certainty"`
+	Urgency       Urgency             `json:"urgency"`
+	Event         string              `json:"event"`
+	Sender        string              `json:"sender"`
+	SenderName    string              `json:"senderName"`
+	Headline      string              `json:"headline"`
+	Description   string              `json:"description"`
+	Instruction   string              `json:"instruction"`
+	Response      string              `json:"response"`
+	Parameters    map[string][]string `json:"parameters"`
+	Geometry      *Geometry           `json:"-"`
+}
+
+// Geocode contains the SAME (FIPS) and UGC codes of the areas affected by the alert.
+type Geocode struct {
+	SAME []string `json:"SAME"`
+	UGC  []string `json:"UGC"`
+}
+
+// Reference identifies a previous alert that is updated or cancelled by this alert.
+type Reference struct {
+	URL        string    `json:"@id,omitempty"`
+	Identifier string    `json:"identifier"`
+	Sender     string    `json:"sender"`
+	Sent       time.Time `json:"sent"`
+}
+
+// Geometry is a GeoJSON geometry object. The coordinates are kept in their raw form
+// since their structure depends on the type of the geometry.
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates,omitempty"`
+	Geometries  []*Geometry     `json:"geometries,omitempty"`
+}
+
+// The GeoJSON feature that wraps the alert properties in the NWS API response.
+type feature struct {
+	ID         string    `json:"id,omitempty"`
+	Type       string    `json:"type"`
+	Geometry   *Geometry `json:"geometry"`
+	Properties *alert    `json:"properties"`
+}
+
+// Used to prevent recursion when marshaling and unmarshaling the alert properties.
+type alert Alert
+
+// UnmarshalJSON decodes an alert from a GeoJSON feature.
+func (a *Alert) UnmarshalJSON(data []byte) (err error) {
+	f := &feature{Properties: (*alert)(a)}
+	if err = json.Unmarshal(data, f); err != nil {
+		return err
+	}
+	a.Geometry = f.Geometry
+	return nil
+}
+
+// MarshalJSON encodes the alert as a GeoJSON feature.
+func (a *Alert) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&feature{
+		ID:         a.URL,
+		Type:       "Feature",
+		Geometry:   a.Geometry,
+		Properties: (*alert)(a),
+	})
+}
+
+// End returns the time the hazard described by the alert is expected to end, which
+// is the ends timestamp if available, otherwise the expiration of the alert message.
+func (a *Alert) End() time.Time {
+	if !a.Ends.IsZero() {
+		return a.Ends
+	}
+	return a.Expires
+}
+
+// Validate checks that the alert has an ID and that its enumerated values are valid.
+func (a *Alert) Validate() error {
+	if a.ID == "" {
+		return ErrNoAlertID
+	}
+
+	if !a.Status.Valid() {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidAlert, a.Status)
+	}
+
+	if !a.MessageType.Valid() {
+		return fmt.Errorf("%w: unknown message type %q", ErrInvalidAlert, a.MessageType)
+	}
+
+	if !a.Severity.Valid() {
+		return fmt.Errorf("%w: unknown severity %q", ErrInvalidAlert, a.Severity)
+	}
+
+	if !a.Certainty.Valid() {
+		return fmt.Errorf("%w: unknown certainty %q", ErrInvalidAlert, a.Certainty)
+	}
+
+	if !a.Urgency.Valid() {
+		return fmt.Errorf("%w: unknown urgency %q", ErrInvalidAlert, a.Urgency)
+	}
+	return nil
+}
+
+//===========================================================================
+// CAP Enumerations
+//===========================================================================
+
+// Severity of the subject event of the alert.
+type Severity string
+
+const (
+	SeverityExtreme  Severity = "Extreme"
+	SeveritySevere   Severity = "Severe"
+	SeverityModerate Severity = "Moderate"
+	SeverityMinor    Severity = "Minor"
+	SeverityUnknown  Severity = "Unknown"
+)
+
+func (s Severity) Valid() bool {
+	switch s {
+	case SeverityExtreme, SeveritySevere, SeverityModerate, SeverityMinor, SeverityUnknown:
+		return true
+	}
+	return false
+}
+
+// Urgency of the subject event of the alert.
+type Urgency string
+
+const (
+	UrgencyImmediate Urgency = "Immediate"
+	UrgencyExpected  Urgency = "Expected"
+	UrgencyFuture    Urgency = "Future"
+	UrgencyPast      Urgency = "Past"
+	UrgencyUnknown   Urgency = "Unknown"
+)
+
+func (u Urgency) Valid() bool {
+	switch u {
+	case UrgencyImmediate, UrgencyExpected, UrgencyFuture, UrgencyPast, UrgencyUnknown:
+		return true
+	}
+	return false
+}
+
+// Certainty of the subject event of the alert.
+type Certainty string
+
+const (
+	CertaintyObserved Certainty = "Observed"
+	CertaintyLikely   Certainty = "Likely"
+	CertaintyPossible Certainty = "Possible"
+	CertaintyUnlikely Certainty = "Unlikely"
+	CertaintyUnknown  Certainty = "Unknown"
+)
+
+func (c Certainty) Valid() bool {
+	switch c {
+	case CertaintyObserved, CertaintyLikely, CertaintyPossible, CertaintyUnlikely, CertaintyUnknown:
+		return true
+	}
+	return false
+}
+
+// Status is the appropriate handling of the alert message.
+type Status string
+
+const (
+	StatusActual   Status = "Actual"
+	StatusExercise Status = "Exercise"
+	StatusSystem   Status = "System"
+	StatusTest     Status = "Test"
+	StatusDraft    Status = "Draft"
+)
+
+func (s Status) Valid() bool {
+	switch s {
+	case StatusActual, StatusExercise, StatusSystem, StatusTest, StatusDraft:
+		return true
+	}
+	return false
+}
+
+// MessageType is the nature of the alert message.
+type MessageType string
+
+const (
+	MessageTypeAlert  MessageType = "Alert"
+	MessageTypeUpdate MessageType = "Update"
+	MessageTypeCancel MessageType = "Cancel"
+	MessageTypeAck    MessageType = "Ack"
+	MessageTypeError  MessageType = "Error"
+)
+
+func (m MessageType) Valid() bool {
+	switch m {
+	case MessageTypeAlert, MessageTypeUpdate, MessageTypeCancel, MessageTypeAck, MessageTypeError:
+		return true
+	}
+	return false
+}
+
+// Category of the subject event of the alert.
+type Category string
+
+const (
+	CategoryMet       Category = "Met"
+	CategoryGeo       Category = "Geo"
+	CategorySafety    Category = "Safety"
+	CategorySecurity  Category = "Security"
+	CategoryRescue    Category = "Rescue"
+	CategoryFire      Category = "Fire"
+	CategoryHealth    Category = "Health"
+	CategoryEnv       Category = "Env"
+	CategoryTransport Category = "Transport"
+	CategoryInfra     Category = "Infra"
+	CategoryCBRNE     Category = "CBRNE"
+	CategoryOther     Category = "Other"
+)
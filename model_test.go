@@ -0,0 +1,116 @@
+package noaalert_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlert(t *testing.T) {
+	features := loadFeatures(t)
+	require.Len(t, features, 374)
+
+	event := &noaalert.AlertEvent{Data: features[0]}
+	alert, err := event.Alert()
+	require.NoError(t, err, "could not decode alert")
+	require.NoError(t, alert.Validate(), "alert should be valid")
+
+	require.Equal(t, "urn:oid:2.49.0.1.840.0.3985f959b1ccf328190bb65adfc62f3673ffb54c.001.1", alert.ID)
+	require.Equal(t, "https://api.weather.gov/alerts/"+alert.ID, alert.URL)
+	require.Equal(t, []string{"025009", "025021", "025025", "025023", "025001"}, alert.Geocode.SAME)
+	require.Equal(t, []string{"MAZ007", "MAZ015", "MAZ016", "MAZ019", "MAZ022"}, alert.Geocode.UGC)
+	require.Len(t, alert.AffectedZones, 5)
+	require.Empty(t, alert.References)
+	require.True(t, alert.Sent.Equal(time.Date(2023, 8, 3, 19, 19, 0, 0, time.UTC)))
+	require.True(t, alert.Expires.Equal(time.Date(2023, 8, 4, 7, 0, 0, 0, time.UTC)))
+	require.Equal(t, noaalert.StatusActual, alert.Status)
+	require.Equal(t, noaalert.MessageTypeAlert, alert.MessageType)
+	require.Equal(t, noaalert.CategoryMet, alert.Category)
+	require.Equal(t, noaalert.SeverityMinor, alert.Severity)
+	require.Equal(t, noaalert.CertaintyLikely, alert.Certainty)
+	require.Equal(t, noaalert.UrgencyExpected, alert.Urgency)
+	require.Equal(t, "Coastal Flood Statement", alert.Event)
+	require.Equal(t, "NWS Boston/Norton MA", alert.SenderName)
+	require.Equal(t, "Do not drive through flooded roadways.", alert.Instruction)
+	require.Equal(t, []string{"CFWBOX"}, alert.Parameters["AWIPSidentifier"])
+	require.Nil(t, alert.Geometry, "expected a null geometry")
+
+	// The alert should be cached on the event
+	cached, err := event.Alert()
+	require.NoError(t, err)
+	require.Same(t, alert, cached)
+
+	// All alerts in the fixture should be valid; check references and geometries
+	var nrefs, ngeoms int
+	for _, data := range features {
+		alert, err := (&noaalert.AlertEvent{Data: data}).Alert()
+		require.NoError(t, err)
+		require.NoError(t, alert.Validate())
+
+		if len(alert.References) > 0 {
+			nrefs++
+			require.NotEmpty(t, alert.References[0].Identifier)
+			require.False(t, alert.References[0].Sent.IsZero())
+		}
+
+		if alert.Geometry != nil {
+			ngeoms++
+			require.Equal(t, "Polygon", alert.Geometry.Type)
+			require.NotEmpty(t, alert.Geometry.Coordinates)
+		}
+	}
+	require.Equal(t, 119, nrefs)
+	require.Equal(t, 50, ngeoms)
+
+	// An alert should round trip as a GeoJSON feature
+	data, err := json.Marshal(alert)
+	require.NoError(t, err)
+	other := &noaalert.Alert{}
+	require.NoError(t, json.Unmarshal(data, other))
+	require.Equal(t, alert, other)
+}
+
+func TestAlertValidate(t *testing.T) {
+	alert := &noaalert.Alert{
+		ID:          "urn:oid:2.49.0.1.840.0.test",
+		Status:      noaalert.StatusTest,
+		MessageType: noaalert.MessageTypeUpdate,
+		Severity:    noaalert.SeveritySevere,
+		Certainty:   noaalert.CertaintyObserved,
+		Urgency:     noaalert.UrgencyImmediate,
+	}
+	require.NoError(t, alert.Validate())
+
+	alert.Severity = "Dangerous"
+	require.ErrorIs(t, alert.Validate(), noaalert.ErrInvalidAlert)
+
+	alert.ID = ""
+	require.ErrorIs(t, alert.Validate(), noaalert.ErrNoAlertID)
+}
+
+// Load the features from the recorded NOAA active alerts response.
+func loadFeatures(t *testing.T) []json.RawMessage {
+	f, err := os.Open("testdata/response.txt.gz")
+	require.NoError(t, err, "could not open fixture")
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err, "could not decompress fixture")
+
+	rep, err := http.ReadResponse(bufio.NewReader(gz), nil)
+	require.NoError(t, err, "could not read recorded response")
+	defer rep.Body.Close()
+
+	collection := struct {
+		Features []json.RawMessage `json:"features"`
+	}{}
+	require.NoError(t, json.NewDecoder(rep.Body).Decode(&collection), "could not decode features")
+	return collection.Features
+}
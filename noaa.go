@@ -4,33 +4,58 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
 const (
-	UserAgent      = "(bbengfort.github.io, benjamin@bengfort.com)"
+	UserAgent      = "noaalert (https://github.com/bbengfort/noaalert)"
 	BaseWeatherURL = "https://api.weather.gov"
+	DefaultTimeout = 30 * time.Second
 )
 
 type Weather struct {
-	client  *http.Client
-	baseURL *url.URL
+	client     *http.Client
+	baseURL    *url.URL
+	mu         sync.Mutex
+	validators map[string]validator
+	expires    time.Time
+	retries    RetryPolicy
+	userAgent  string
+	acceptLang string
+	zones      map[string]*Geometry
+	zoneCache  string
 }
 
-func NewWeatherAPI() (api *Weather, err error) {
+// The cache validators of a previous response used to make conditional requests.
+type validator struct {
+	lastModified string
+	etag         string
+}
+
+func NewWeatherAPI(opts ...WeatherOption) (api *Weather, err error) {
 	api = &Weather{
 		client: &http.Client{
 			Transport:     nil,
 			CheckRedirect: nil,
-			Timeout:       30 * time.Second,
+			Timeout:       DefaultTimeout,
 		},
+		validators: make(map[string]validator),
+		zones:      make(map[string]*Geometry),
+		retries:    DefaultRetryPolicy,
+		userAgent:  UserAgent,
+		acceptLang: acceptLang,
 	}
 
 	if api.client.Jar, err = cookiejar.New(nil); err != nil {
@@ -41,19 +66,74 @@ func NewWeatherAPI() (api *Weather, err error) {
 		return nil, err
 	}
 
+	for _, opt := range opts {
+		if err = opt(api); err != nil {
+			return nil, err
+		}
+	}
+
 	return api, nil
 }
 
-func (s *Weather) Alerts(ctx context.Context) (_ []*AlertEvent, err error) {
+// Alerts fetches the active alerts from api.weather.gov. If a query is specified then
+// the alerts are filtered by the NWS using the query parameters; the active alerts
+// endpoint is not paginated so the limit of the query is ignored. Alerts are fetched
+// with a conditional request; if the alerts have not been modified since the previous
+// call then ErrNotModified is returned, meaning there are no new alerts.
+func (s *Weather) Alerts(ctx context.Context, query *AlertsQuery) (_ []*AlertEvent, err error) {
+	var params url.Values
+	if query != nil {
+		if err = query.Validate(); err != nil {
+			return nil, err
+		}
+		params = query.Values()
+		params.Del("limit")
+	}
+
 	var req *http.Request
-	if req, err = s.NewRequest(ctx, http.MethodGet, "/alerts/active", nil, nil); err != nil {
+	if req, err = s.NewRequest(ctx, http.MethodGet, "/alerts/active", nil, &params); err != nil {
 		return nil, err
 	}
+	s.SetConditional(req)
+
+	// The freshness of the active alerts determines when they should be polled again.
+	var (
+		events []*AlertEvent
+		rep    *http.Response
+	)
+	events, rep, _, err = s.fetchAlerts(req)
+	if rep != nil {
+		s.mu.Lock()
+		s.expires = freshness(rep)
+		s.mu.Unlock()
+	}
 
-	var rep *http.Response
-	alerts := make(map[string]interface{})
-	if rep, err = s.Do(req, &alerts, true); err != nil {
-		logctx := log.With().Err(err).Logger()
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// The GeoJSON feature collection returned by the api.weather.gov alerts endpoints.
+type featureCollection struct {
+	Features   []json.RawMessage `json:"features"`
+	Pagination *struct {
+		Next string `json:"next"`
+	} `json:"pagination,omitempty"`
+}
+
+// Execute an alerts request and convert the features in the response into events. If
+// the response is paginated, the URL of the next page is also returned along with the
+// response, which is returned even if the alerts were not modified.
+func (s *Weather) fetchAlerts(req *http.Request) (events []*AlertEvent, rep *http.Response, next string, err error) {
+	alerts := &featureCollection{}
+	if rep, err = s.Do(req, alerts, true); err != nil {
+		if errors.Is(err, ErrNotModified) {
+			log.Debug().Str("url", req.URL.String()).Msg("alerts not modified")
+			return nil, rep, "", err
+		}
+
+		logctx := log.With().Err(err).Str("url", req.URL.String()).Logger()
 		if rep != nil {
 			// Get the NOAA request headers to log the error
 			correlationID := rep.Header.Get("X-Correlation-Id")
@@ -66,44 +146,49 @@ func (s *Weather) Alerts(ctx context.Context) (_ []*AlertEvent, err error) {
 				Str("server_id", serverID).
 				Logger()
 		}
-		logctx.Error().Msg("could not fetch active alerts")
-		return nil, err
+		logctx.Error().Msg("could not fetch alerts")
+		return nil, nil, "", err
 	}
 
-	if features, ok := alerts["features"]; ok {
-		if featureList, ok := features.([]interface{}); ok {
-			// Get the NOAA request headers to create events
-			correlationID := rep.Header.Get("X-Correlation-Id")
-			requestID := rep.Header.Get("X-Request-Id")
-			serverID := rep.Header.Get("X-Server-Id")
-			lastModified := rep.Header.Get("Last-Modified")
-			expires := rep.Header.Get("Expires")
-
-			events := make([]*AlertEvent, 0, len(featureList))
-			for _, feature := range featureList {
-				event := &AlertEvent{
-					CorrelationID: correlationID,
-					RequestID:     requestID,
-					ServerID:      serverID,
-					LastModified:  lastModified,
-					Expires:       expires,
-				}
+	if alerts.Features == nil {
+		return nil, rep, "", fmt.Errorf("no alerts returned")
+	}
 
-				if event.Data, err = json.Marshal(feature); err != nil {
-					return nil, err
-				}
+	// Get the NOAA request headers to create events
+	correlationID := rep.Header.Get("X-Correlation-Id")
+	requestID := rep.Header.Get("X-Request-Id")
+	serverID := rep.Header.Get("X-Server-Id")
+	lastModified := rep.Header.Get("Last-Modified")
+	expires := rep.Header.Get("Expires")
 
-				events = append(events, event)
-			}
+	events = make([]*AlertEvent, 0, len(alerts.Features))
+	for _, feature := range alerts.Features {
+		event := &AlertEvent{
+			CorrelationID: correlationID,
+			RequestID:     requestID,
+			ServerID:      serverID,
+			LastModified:  lastModified,
+			Expires:       expires,
+		}
 
-			return events, nil
+		data := &bytes.Buffer{}
+		if err = json.Compact(data, feature); err != nil {
+			return nil, rep, "", err
 		}
+		event.Data = data.Bytes()
+
+		events = append(events, event)
+	}
+
+	if alerts.Pagination != nil {
+		next = alerts.Pagination.Next
 	}
-	return nil, fmt.Errorf("no alerts returned")
+	return events, rep, next, nil
 }
 
 const (
 	accept      = "application/geo+json"
+	problemJSON = "application/problem+json"
 	acceptLang  = "en-US,en"
 	contentType = "application/json; charset=utf-8"
 )
@@ -114,7 +199,11 @@ func (s *Weather) NewRequest(ctx context.Context, method, path string, data inte
 	if params != nil && len(*params) > 0 {
 		url.RawQuery = params.Encode()
 	}
+	return s.newRequest(ctx, method, url, data)
+}
 
+// Create a request to the fully resolved URL, e.g. a pagination link from the API.
+func (s *Weather) newRequest(ctx context.Context, method string, url *url.URL, data interface{}) (req *http.Request, err error) {
 	var body io.ReadWriter
 	switch {
 	case data == nil:
@@ -132,9 +221,9 @@ func (s *Weather) NewRequest(ctx context.Context, method, path string, data inte
 	}
 
 	// Set the headers on the request
-	req.Header.Add("User-Agent", UserAgent)
+	req.Header.Add("User-Agent", s.userAgent)
 	req.Header.Add("Accept", accept)
-	req.Header.Add("Accept-Language", acceptLang)
+	req.Header.Add("Accept-Language", s.acceptLang)
 
 	if body != nil {
 		req.Header.Add("Content-Type", contentType)
@@ -154,24 +243,37 @@ func (s *Weather) NewRequest(ctx context.Context, method, path string, data inte
 }
 
 // Do executes an http request against the server, performs error checking, and
-// deserializes the response data into the specified struct.
+// deserializes the response data into the specified struct. The validators of
+// successful GET responses are remembered so that subsequent requests to the same URL
+// can be made conditional; if the server responds 304 Not Modified to a conditional
+// request then ErrNotModified is returned. Failed requests are retried according to
+// the retry policy of the Weather client.
 func (s *Weather) Do(req *http.Request, data interface{}, checkStatus bool) (rep *http.Response, err error) {
-	if rep, err = s.client.Do(req); err != nil {
+	if rep, err = s.execute(req); err != nil {
 		return rep, fmt.Errorf("could not execute request: %s", err)
 	}
 	defer rep.Body.Close()
 
+	if rep.StatusCode == http.StatusNotModified {
+		return rep, ErrNotModified
+	}
+
 	// Detect http status errors if they've occurred
 	if checkStatus {
 		if rep.StatusCode < 200 || rep.StatusCode >= 300 {
-			return rep, fmt.Errorf("[%d] %s", rep.StatusCode, rep.Status)
+			return rep, problem(rep)
 		}
 	}
 
 	// Deserialize the JSON data from the body
 	if data != nil && rep.StatusCode >= 200 && rep.StatusCode < 300 && rep.StatusCode != http.StatusNoContent {
 		// Check the content type to ensure data deserialization is possible
-		if ct := rep.Header.Get("Content-Type"); ct != accept {
+		ct := rep.Header.Get("Content-Type")
+		switch mediaType(ct) {
+		case accept:
+		case problemJSON:
+			return rep, problem(rep)
+		default:
 			return rep, fmt.Errorf("unexpected content type: %q", ct)
 		}
 
@@ -180,9 +282,175 @@ func (s *Weather) Do(req *http.Request, data interface{}, checkStatus bool) (rep
 		}
 	}
 
+	// Only remember the validators once the response has been successfully handled,
+	// otherwise a failed response would never be fetched again.
+	if req.Method == http.MethodGet && rep.StatusCode == http.StatusOK {
+		s.setValidator(req.URL.String(), rep)
+	}
 	return rep, nil
 }
 
+// Create an APIError from the response, decoding the problem document in the body if
+// one was returned. Missing fields are populated from the response status and headers.
+func problem(rep *http.Response) error {
+	err := &APIError{}
+	if mediaType(rep.Header.Get("Content-Type")) == problemJSON {
+		if derr := json.NewDecoder(rep.Body).Decode(err); derr != nil {
+			log.Debug().Err(derr).Msg("could not decode problem document")
+		}
+	}
+
+	if err.Status == 0 {
+		err.Status = rep.StatusCode
+	}
+
+	if err.Title == "" {
+		err.Title = http.StatusText(err.Status)
+	}
+
+	if err.CorrelationID == "" {
+		err.CorrelationID = rep.Header.Get("X-Correlation-Id")
+	}
+	return err
+}
+
+// Returns the media type of the content type header without any parameters.
+func mediaType(ct string) string {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ct
+	}
+	return mt
+}
+
+// Execute the request, retrying network errors and retryable status codes with backoff
+// according to the retry policy. The response of the final attempt is returned.
+func (s *Weather) execute(req *http.Request) (rep *http.Response, err error) {
+	policy := s.retryPolicy()
+	for attempt := 1; ; attempt++ {
+		rep, err = s.client.Do(req)
+		if attempt >= policy.MaxAttempts || !policy.Retryable(req, rep, err) {
+			if attempt > 1 {
+				logctx := log.With().Int("attempts", attempt).Str("url", req.URL.String()).Logger()
+				if rep != nil {
+					logctx = logctx.With().
+						Int("status", rep.StatusCode).
+						Str("correlation_id", rep.Header.Get("X-Correlation-Id")).
+						Str("request_id", rep.Header.Get("X-Request-Id")).
+						Logger()
+				}
+				logctx.Debug().Err(err).Msg("completed request after retries")
+			}
+			return rep, err
+		}
+
+		delay, ok := policy.Delay(attempt, rep)
+		logctx := log.With().Int("attempt", attempt).Dur("delay", delay).Str("url", req.URL.String()).Logger()
+		if rep != nil {
+			logctx = logctx.With().
+				Int("status", rep.StatusCode).
+				Str("correlation_id", rep.Header.Get("X-Correlation-Id")).
+				Str("request_id", rep.Header.Get("X-Request-Id")).
+				Str("server_id", rep.Header.Get("X-Server-Id")).
+				Logger()
+		}
+
+		if !ok {
+			logctx.Warn().Err(err).Msg("server requested retry after the max delay, giving up")
+			return rep, err
+		}
+		logctx.Warn().Err(err).Msg("request to noaa failed, retrying")
+
+		// Discard the failed response so that the connection can be reused.
+		if rep != nil {
+			io.Copy(io.Discard, rep.Body)
+			rep.Body.Close()
+		}
+
+		if err = sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// SetConditional adds the If-Modified-Since and If-None-Match headers to the request if
+// a previous response from the same URL had validators and the headers are not set.
+func (s *Weather) SetConditional(req *http.Request) {
+	s.mu.Lock()
+	v, ok := s.validators[req.URL.String()]
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if v.lastModified != "" && req.Header.Get("If-Modified-Since") == "" {
+		req.Header.Set("If-Modified-Since", v.lastModified)
+	}
+
+	if v.etag != "" && req.Header.Get("If-None-Match") == "" {
+		req.Header.Set("If-None-Match", v.etag)
+	}
+}
+
+func (s *Weather) setValidator(key string, rep *http.Response) {
+	v := validator{
+		lastModified: rep.Header.Get("Last-Modified"),
+		etag:         rep.Header.Get("ETag"),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v.lastModified == "" && v.etag == "" {
+		delete(s.validators, key)
+		return
+	}
+	s.validators[key] = v
+}
+
+// Expires returns when the most recent active alerts response expires according to its
+// cache headers; polling before this time will not return new data. Other requests,
+// such as for zone geometries, do not affect it. A zero time is returned if the
+// response did not specify its freshness.
+func (s *Weather) Expires() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expires
+}
+
+// Returns when the response expires using the Cache-Control max-age directive, falling
+// back to the Expires header if no max-age is specified.
+func freshness(rep *http.Response) time.Time {
+	for _, directive := range strings.Split(rep.Header.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.HasPrefix(directive, "max-age=") {
+			if maxAge, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil {
+				age, _ := strconv.Atoi(rep.Header.Get("Age"))
+				return time.Now().Add(time.Duration(maxAge-age) * time.Second)
+			}
+		}
+	}
+
+	if expires, err := http.ParseTime(rep.Header.Get("Expires")); err == nil {
+		return expires
+	}
+	return time.Time{}
+}
+
+// ResetValidators forgets the validators of all previous responses so that the next
+// requests are unconditional and always return the full response.
+func (s *Weather) ResetValidators() {
+	s.mu.Lock()
+	s.validators = make(map[string]validator)
+	s.mu.Unlock()
+}
+
 func (s *Weather) SetBaseURL(u *url.URL) {
 	s.baseURL = u
 }
@@ -0,0 +1,227 @@
+package noaalert_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalAlerts(t *testing.T) {
+	const (
+		etag         = `"7fd4a3b9"`
+		lastModified = "Thu, 03 Aug 2023 19:20:03 GMT"
+	)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(`{"features":[{"properties":{"id":"alert-1"}}]}`))
+	}))
+	defer srv.Close()
+
+	api, err := noaalert.NewWeatherAPI()
+	require.NoError(t, err)
+	u, _ := url.Parse(srv.URL)
+	api.SetBaseURL(u)
+
+	alerts, err := api.Alerts(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	require.Equal(t, lastModified, alerts[0].LastModified)
+
+	alerts, err = api.Alerts(context.Background(), nil)
+	require.ErrorIs(t, err, noaalert.ErrNotModified)
+	require.Empty(t, alerts)
+
+	// A different query is a different URL and should not be conditional
+	alerts, err = api.Alerts(context.Background(), &noaalert.AlertsQuery{Area: []string{"MA"}})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+
+	// Once the validators are reset the full response should be returned
+	api.ResetValidators()
+	alerts, err = api.Alerts(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	require.Equal(t, 4, requests)
+}
+
+func TestRetries(t *testing.T) {
+	failures, requests := 2, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("area") == "KS" {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		if requests <= failures {
+			w.Header().Set("X-Correlation-Id", "45d6d42e")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.Write([]byte(`{"features":[{"properties":{"id":"alert-1"}}]}`))
+	}))
+	defer srv.Close()
+
+	api, err := noaalert.NewWeatherAPI()
+	require.NoError(t, err)
+	u, _ := url.Parse(srv.URL)
+	api.SetBaseURL(u)
+	api.SetRetryPolicy(noaalert.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+
+	alerts, err := api.Alerts(context.Background(), nil)
+	require.NoError(t, err, "request should succeed after retries")
+	require.Len(t, alerts, 1)
+	require.Equal(t, 3, requests)
+
+	// Should give up once the max attempts are exceeded
+	requests, failures = 0, 5
+	_, err = api.Alerts(context.Background(), &noaalert.AlertsQuery{Area: []string{"MA"}})
+	require.Error(t, err)
+	require.Equal(t, 3, requests)
+
+	// Should not wait if the server asks to retry after longer than the max delay
+	requests = 0
+	_, err = api.Alerts(context.Background(), &noaalert.AlertsQuery{Area: []string{"KS"}})
+	require.Error(t, err)
+	require.Equal(t, 1, requests)
+
+	// Should not retry if retries are disabled
+	requests, failures = 0, 5
+	api.SetRetryPolicy(noaalert.NoRetries)
+	_, err = api.Alerts(context.Background(), &noaalert.AlertsQuery{Area: []string{"NH"}})
+	require.Error(t, err)
+	require.Equal(t, 1, requests)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := noaalert.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	get, _ := http.NewRequest(http.MethodGet, "https://api.weather.gov/alerts", nil)
+	post, _ := http.NewRequest(http.MethodPost, "https://api.weather.gov/alerts", nil)
+
+	for _, code := range []int{429, 500, 502, 503, 504} {
+		rep := &http.Response{StatusCode: code}
+		require.True(t, policy.Retryable(get, rep, nil), "expected %d to be retryable", code)
+		require.False(t, policy.Retryable(post, rep, nil), "expected post to not be retryable")
+	}
+
+	for _, code := range []int{200, 304, 400, 403, 404, 501} {
+		require.False(t, policy.Retryable(get, &http.Response{StatusCode: code}, nil), "expected %d to not be retryable", code)
+	}
+	require.True(t, policy.Retryable(get, nil, errors.New("connection reset by peer")))
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		actual, ok := policy.Delay(i+1, nil)
+		require.True(t, ok)
+		require.Equal(t, delay, actual)
+	}
+
+	rep := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	delay, ok := policy.Delay(1, rep)
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, delay)
+
+	rep.Header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	_, ok = policy.Delay(1, rep)
+	require.False(t, ok, "retry after exceeds the max delay")
+}
+
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("area") {
+		case "XX":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"correlationId":"19ae6b07","title":"Bad Request","type":"https://api.weather.gov/problems/BadRequest","status":400,"detail":"Query parameter \"area\" is invalid","instance":"https://api.weather.gov/requests/19ae6b07","parameterErrors":[{"parameter":"area","message":"Does not have a value in the enumeration"}]}`))
+		case "MA":
+			w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+			w.Write([]byte(`{"title":"Unexpected Problem","type":"https://api.weather.gov/problems/UnexpectedProblem","status":500,"detail":"An unexpected problem has occurred."}`))
+		default:
+			w.Header().Set("X-Correlation-Id", "45d6d42e")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	api, err := noaalert.NewWeatherAPI()
+	require.NoError(t, err)
+	u, _ := url.Parse(srv.URL)
+	api.SetBaseURL(u)
+	api.SetRetryPolicy(noaalert.NoRetries)
+
+	_, err = api.Alerts(context.Background(), &noaalert.AlertsQuery{Area: []string{"XX"}})
+	target := &noaalert.APIError{}
+	require.ErrorAs(t, err, &target)
+	require.True(t, target.InvalidParameters())
+	require.False(t, target.Unavailable())
+	require.Equal(t, "19ae6b07", target.CorrelationID)
+	require.Equal(t, "https://api.weather.gov/problems/BadRequest", target.Type)
+	require.Len(t, target.ParameterErrors, 1)
+	require.EqualError(t, err, `[400] Bad Request: Query parameter "area" is invalid`)
+
+	// A problem document with a success status should still be an error
+	_, err = api.Alerts(context.Background(), &noaalert.AlertsQuery{Area: []string{"MA"}})
+	require.ErrorAs(t, err, &target)
+	require.Equal(t, 500, target.Status)
+	require.True(t, target.Unavailable())
+
+	// Errors without a problem document are populated from the response
+	_, err = api.Alerts(context.Background(), nil)
+	require.ErrorAs(t, err, &target)
+	require.True(t, target.Unavailable())
+	require.False(t, target.RateLimited())
+	require.Equal(t, "45d6d42e", target.CorrelationID)
+	require.EqualError(t, err, "[503] Service Unavailable")
+}
+
+func TestWeatherOptions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "(example.com, ops@example.com)", r.Header.Get("User-Agent"))
+		require.Equal(t, "fr-CA", r.Header.Get("Accept-Language"))
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.Write([]byte(`{"features":[]}`))
+	}))
+	defer srv.Close()
+
+	api, err := noaalert.NewWeatherAPI(
+		noaalert.WithUserAgent("(example.com, ops@example.com)"),
+		noaalert.WithBaseURL(srv.URL),
+		noaalert.WithTimeout(time.Second),
+		noaalert.WithAcceptLanguage("fr-CA"),
+	)
+	require.NoError(t, err)
+
+	alerts, err := api.Alerts(context.Background(), nil)
+	require.NoError(t, err)
+	require.Empty(t, alerts)
+
+	_, err = noaalert.NewWeatherAPI(noaalert.WithBaseURL("/alerts"))
+	require.Error(t, err, "base url must be absolute")
+
+	_, err = noaalert.NewWeatherAPI(noaalert.WithUserAgent(""))
+	require.Error(t, err, "user agent is required")
+
+	_, err = noaalert.NewWeatherAPI(noaalert.WithTimeout(-1))
+	require.Error(t, err, "timeout cannot be negative")
+}
@@ -2,11 +2,12 @@ package noaalert
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 
-	sdk "github.com/rotationalio/go-ensign"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -19,14 +20,20 @@ func init() {
 }
 
 type Publisher struct {
-	api     *Weather
-	ensign  *sdk.Client
-	conf    Config
-	started time.Time
-	echan   chan error
+	api      *Weather
+	sinks    []Sink
+	store    Store
+	schedule *Scheduler
+	conf     Config
+	started  time.Time
+
+	mu       sync.RWMutex
+	stats    PublishStats
+	totals   PublishStats
+	failures []Failure
 }
 
-func New(conf Config) (pub *Publisher, err error) {
+func New(conf Config, sinks ...Sink) (pub *Publisher, err error) {
 	if conf.IsZero() {
 		if conf, err = NewConfig(); err != nil {
 			return nil, err
@@ -37,24 +44,44 @@ func New(conf Config) (pub *Publisher, err error) {
 		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	}
 
+	min, max := conf.IntervalBounds()
 	pub = &Publisher{
-		conf:  conf,
-		echan: make(chan error, 1),
+		conf:     conf,
+		schedule: NewScheduler(conf.Interval, min, max, conf.IntervalJitter),
 	}
 
 	// Connect to Weather.gov
-	if pub.api, err = NewWeatherAPI(); err != nil {
+	if pub.api, err = NewWeatherAPI(conf.Weather.Options()...); err != nil {
 		return nil, err
 	}
 
-	// Connect to Ensign
-	if pub.ensign, err = sdk.New(conf.Ensign.Options()...); err != nil {
+	// The NWS contacts operators about problematic traffic using the User-Agent, so a
+	// publisher cannot poll on behalf of the project with the default.
+	if conf.Weather.UserAgent == "" {
+		if !conf.DryRun {
+			return nil, ErrNoUserAgent
+		}
+		log.Warn().Str("user_agent", UserAgent).Msg("using the default user agent; set NOAALERT_WEATHER_USER_AGENT to identify this deployment to the NWS")
+	}
+
+	// A dry run logs the alerts instead of publishing them and does not modify the store
+	if conf.DryRun {
+		log.Warn().Msg("dry run: alerts will be logged but not published")
+		if pub.store, err = openDryRunStore(conf.StorePath); err != nil {
+			return nil, err
+		}
+		pub.sinks = []Sink{NewDryRunSink()}
+		return pub, nil
+	}
+
+	// Open the store of previously published alerts
+	if pub.store, err = OpenStore(conf.StorePath); err != nil {
 		return nil, err
 	}
 
-	// If we need to ensure the topic exists, perform the check.
-	if conf.EnsureTopicExists {
-		if err = EnsureTopicExists(pub.ensign, conf.Topic); err != nil {
+	// Open the configured sinks unless sinks were specified by the caller
+	if pub.sinks = sinks; len(pub.sinks) == 0 {
+		if pub.sinks, err = openSinks(conf); err != nil {
 			return nil, err
 		}
 	}
@@ -62,72 +89,234 @@ func New(conf Config) (pub *Publisher, err error) {
 	return pub, nil
 }
 
+// Run publishes the alerts on every interval tick until the process is interrupted, then
+// shuts the publisher down once the alerts that are being published have been acked.
 func (p *Publisher) Run() error {
-	// Catch OS signals for graceful shutdowns
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	go func() {
-		<-quit
-		p.echan <- p.Shutdown()
-	}()
+	// Catch OS signals for graceful shutdowns. Cancelling the context stops retrying
+	// alerts that are still being delivered; the sinks and store are only closed after
+	// the tick returns so that the acked alerts are recorded as published.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
 	p.started = time.Now()
-	ticker := time.NewTicker(p.conf.Interval)
-	log.Info().Dur("interval", p.conf.Interval).Str("topic", p.conf.Topic).Msg("starting alerts publisher")
+	timer := time.NewTimer(p.conf.Interval)
+	defer timer.Stop()
+	min, max := p.conf.IntervalBounds()
+	log.Info().
+		Dur("interval", p.conf.Interval).
+		Dur("min_interval", min).
+		Dur("max_interval", max).
+		Str("topic", p.conf.Topic).
+		Bool("dry_run", p.conf.DryRun).
+		Msg("starting alerts publisher")
 
 	// Begin API query loop
-queryLoop:
 	for {
 		select {
-		case err := <-p.echan:
-			return err
-		case <-ticker.C:
-			log.Debug().Msg("starting collection of noaa alerts")
-
-			count := 0
-			for alert := range p.Alerts() {
-				if err := p.ensign.Publish(p.conf.Topic, alert); err != nil {
-					log.Error().Err(err).Int("count", count).Msg("could not publish weather alert")
-					continue queryLoop
-				}
-
-				// TODO: check acks/nacks
-				count++
+		case <-ctx.Done():
+			return p.Shutdown()
+		case <-timer.C:
+			if ctx.Err() != nil {
+				return p.Shutdown()
 			}
-			log.Info().Str("topic", p.conf.Topic).Int("count", count).Msg("weather alerts published")
+
+			result, _ := p.tick(ctx)
+			delay := p.schedule.Next(result)
+			timer.Reset(delay)
+			log.Debug().Dur("delay", delay).Msg("next collection of noaa alerts scheduled")
 		}
 	}
 }
 
+// Publish polls NOAA for the active alerts once and publishes the alerts that are new
+// or have changed since they were last published, along with the expirations of the
+// active alerts that have ended or been removed from the feed. Run publishes on every
+// interval tick; Publish can be used to publish the alerts on a different schedule.
+func (p *Publisher) Publish(ctx context.Context) (PublishStats, error) {
+	result, stats := p.tick(ctx)
+	return stats, result.Err
+}
+
+// Poll and publish the alerts for a single interval tick, returning the result of the
+// poll that is used to schedule the next tick.
+func (p *Publisher) tick(ctx context.Context) (PollResult, PublishStats) {
+	log.Debug().Msg("starting collection of noaa alerts")
+
+	alerts, current, err := p.poll(ctx)
+	alerts = append(alerts, p.expirations(current, superseded(alerts))...)
+	stats := p.publish(ctx, alerts)
+	p.record(stats)
+
+	// Dropped alerts are not recorded as published, so the next poll is unconditional to
+	// send them again even if the alerts have not been modified since this poll.
+	if stats.Dropped > 0 {
+		p.api.ResetValidators()
+	}
+
+	log.Info().
+		Str("topic", p.conf.Topic).
+		Bool("dry_run", p.conf.DryRun).
+		Uint64("published", stats.Published).
+		Uint64("acked", stats.Acked).
+		Uint64("nacked", stats.Nacked).
+		Uint64("retried", stats.Retried).
+		Uint64("dropped", stats.Dropped).
+		Msg("weather alerts published")
+
+	if pruned, err := p.store.Prune(time.Now().Add(-p.conf.StoreRetention)); err != nil {
+		log.Warn().Err(err).Msg("could not prune published alerts store")
+	} else if pruned > 0 {
+		log.Debug().Int("pruned", pruned).Msg("pruned expired alerts from store")
+	}
+
+	return PollResult{Err: err, NewAlerts: len(alerts), Expires: p.api.Expires()}, stats
+}
+
 func (p *Publisher) Shutdown() (err error) {
 	log.Info().Msg("shutting alert publisher down")
-	if err = p.ensign.Close(); err != nil {
+	for _, sink := range p.sinks {
+		if err = sink.Close(); err != nil {
+			return err
+		}
+	}
+	if err = p.store.Close(); err != nil {
 		return err
 	}
 	log.Debug().Msg("gracefully shut down alert publisher")
 	return nil
 }
 
-func (p *Publisher) Alerts() <-chan *sdk.Event {
-	events := make(chan *sdk.Event)
-	go func(events chan<- *sdk.Event) {
+// Alerts fetches the active alerts from NOAA and returns only the alerts that are new
+// or have changed since they were last published.
+func (p *Publisher) Alerts() <-chan *AlertEvent {
+	events := make(chan *AlertEvent)
+	go func(events chan<- *AlertEvent) {
 		defer close(events)
+		alerts, _, _ := p.poll(context.Background())
+		for _, alert := range alerts {
+			events <- alert
+		}
+	}(events)
+	return events
+}
 
-		// TODO: set default timeout in configuration
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
+// Fetch the active alerts from NOAA, filtering out alerts that have already been
+// published. The IDs of all alerts in the feed are also returned so that alerts that
+// have been removed from the feed can be expired. If NOAA reports that the alerts have
+// not been modified, no alerts, a nil set of IDs, and no error are returned.
+func (p *Publisher) poll(ctx context.Context) (_ []*AlertEvent, current map[string]struct{}, err error) {
+	// TODO: set default timeout in configuration
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
 
-		alerts, err := p.api.Alerts(ctx)
-		if err != nil {
-			log.Warn().Err(err).Msg("could not fetch noaa alerts")
-			return
+	var alerts []*AlertEvent
+	if alerts, err = p.api.Alerts(ctx, &p.conf.Alerts); err != nil {
+		if errors.Is(err, ErrNotModified) {
+			log.Debug().Msg("no new alerts from NOAA")
+			return nil, nil, nil
 		}
+		log.Warn().Err(err).Msg("could not fetch noaa alerts")
+		return nil, nil, err
+	}
 
-		log.Debug().Int("nalerts", len(alerts)).Msg("received alerts from NOAA")
-		for _, alert := range alerts {
-			// TODO: don't republish alerts
-			events <- alert.Event()
+	log.Debug().Int("nalerts", len(alerts)).Msg("received alerts from NOAA")
+
+	skipped := 0
+	current = make(map[string]struct{}, len(alerts))
+	events := make([]*AlertEvent, 0, len(alerts))
+	for _, alert := range alerts {
+		if rec, err := alert.Record(); err == nil {
+			current[rec.ID] = struct{}{}
 		}
-	}(events)
-	return events
+
+		if !p.isNew(alert) {
+			skipped++
+			continue
+		}
+		events = append(events, alert)
+	}
+	log.Debug().Int("skipped", skipped).Msg("skipped previously published alerts")
+	return events, current, nil
+}
+
+// Number of historical alerts published together when backfilling.
+const backfillBatchSize = 100
+
+// Backfill publishes the alerts issued between the start and end times that have not
+// already been published, e.g. to recover alerts issued while the publisher was down.
+// Alerts are fetched from the NWS history endpoint using the configured alerts query.
+// Only the store records which alerts were published by a previous process, so unless
+// this is a dry run ErrNoStorePath is returned if the store is not durable.
+func (p *Publisher) Backfill(ctx context.Context, start, end time.Time) (stats PublishStats, err error) {
+	if p.conf.StorePath == "" && !p.conf.DryRun {
+		return stats, ErrNoStorePath
+	}
+
+	log.Info().Time("start", start).Time("end", end).Str("topic", p.conf.Topic).Msg("backfilling weather alerts")
+
+	skipped := 0
+	batch := make([]*AlertEvent, 0, backfillBatchSize)
+	alerts := p.api.History(ctx, start, end, &p.conf.Alerts)
+	for alerts.Next() {
+		alert := alerts.Alert()
+		if !p.isNew(alert) {
+			skipped++
+			continue
+		}
+
+		batch = append(batch, alert)
+		if len(batch) == backfillBatchSize {
+			stats.add(p.publish(ctx, batch))
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		stats.add(p.publish(ctx, batch))
+	}
+	p.record(stats)
+
+	log.Info().
+		Int("pages", alerts.Pages()).
+		Int("skipped", skipped).
+		Uint64("published", stats.Published).
+		Uint64("acked", stats.Acked).
+		Uint64("dropped", stats.Dropped).
+		Msg("weather alerts backfilled")
+	return stats, alerts.Error()
+}
+
+// Returns true if the alert has not been published or has changed since it was. Alerts
+// that cannot be identified are skipped, otherwise they would be published on every
+// tick since they can never be recorded as published.
+func (p *Publisher) isNew(alert *AlertEvent) bool {
+	rec, err := alert.Record()
+	if err != nil {
+		log.Warn().Err(err).Str("request_id", alert.RequestID).Msg("could not identify alert, skipping")
+		return false
+	}
+
+	var seen bool
+	if seen, err = Seen(p.store, rec); err != nil {
+		log.Warn().Err(err).Str("alert_id", rec.ID).Msg("could not check if alert was published")
+	}
+	return !seen
+}
+
+// Record the alert in the store so that it is not published again. Alerts that are
+// superseded by the alert, or that expired, are no longer active.
+func (p *Publisher) markPublished(alert *AlertEvent) (err error) {
+	var rec *Record
+	if rec, err = alert.Record(); err != nil {
+		return err
+	}
+
+	if alert.EventType() == AlertExpiredType {
+		return p.deactivate(rec.ID)
+	}
+
+	if err = p.store.Put(rec); err != nil {
+		return err
+	}
+	return p.deactivate(alert.Supersedes()...)
 }
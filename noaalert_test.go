@@ -0,0 +1,365 @@
+package noaalert_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/bbengfort/noaalert/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Publishers are required to identify their operator to the NWS.
+const testUserAgent = "(example.com, ops@example.com)"
+
+func TestBackfill(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 250; i++ {
+		nws.Issue(&noaalert.Alert{Sent: now.Add(-time.Duration(i) * time.Second)})
+	}
+
+	conf, err := noaalert.Config{
+		Topic:          "noaa-alerts",
+		Interval:       5 * time.Minute,
+		AckTimeout:     time.Second,
+		PublishBackoff: time.Millisecond,
+		Alerts:         noaalert.AlertsQuery{Limit: 75},
+		Weather:        noaalert.WeatherConfig{UserAgent: testUserAgent, BaseURL: nws.URL().String()},
+	}.Mark()
+	require.NoError(t, err)
+
+	// Publishers must be configured with the operator's user agent
+	conf.Weather.UserAgent = ""
+	_, err = noaalert.New(conf, &batchSink{})
+	require.ErrorIs(t, err, noaalert.ErrNoUserAgent)
+	conf.Weather.UserAgent = testUserAgent
+
+	// Backfilling requires a durable store to skip alerts published by earlier processes
+	sink := &batchSink{}
+	pub, err := noaalert.New(conf, sink)
+	require.NoError(t, err)
+	_, err = pub.Backfill(context.Background(), now.Add(-time.Hour), time.Time{})
+	require.ErrorIs(t, err, noaalert.ErrNoStorePath)
+	require.NoError(t, pub.Shutdown())
+
+	conf.StorePath = filepath.Join(t.TempDir(), "alerts.jsonl")
+	pub, err = noaalert.New(conf, sink)
+	require.NoError(t, err)
+
+	stats, err := pub.Backfill(context.Background(), now.Add(-time.Hour), time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(250), stats.Published)
+	require.Equal(t, uint64(250), stats.Acked)
+	require.NoError(t, pub.Shutdown())
+
+	// Alerts are published in batches of 100 across pages of the history
+	require.Equal(t, []int{100, 100, 50}, sink.batches())
+
+	// A new publisher with the same store does not publish the alerts again
+	pub, err = noaalert.New(conf, sink)
+	require.NoError(t, err)
+	defer pub.Shutdown()
+
+	stats, err = pub.Backfill(context.Background(), now.Add(-time.Hour), time.Time{})
+	require.NoError(t, err)
+	require.Zero(t, stats.Published)
+}
+
+// A sink that records the number of alerts published before each wait for acks; the
+// publisher sends every alert in a batch before waiting so each wait ends a batch.
+type batchSink struct {
+	mu      sync.Mutex
+	sent    int
+	waited  int
+	counted []int
+}
+
+func (s *batchSink) Name() string { return "batch" }
+func (s *batchSink) Close() error { return nil }
+
+func (s *batchSink) Publish(*noaalert.AlertEvent) (noaalert.Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent++
+	return s, nil
+}
+
+func (s *batchSink) Wait(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sent > s.waited {
+		s.counted = append(s.counted, s.sent-s.waited)
+		s.waited = s.sent
+	}
+	return nil
+}
+
+func (s *batchSink) batches() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counted
+}
+
+func TestPublishDedupe(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	nws.Issue(&noaalert.Alert{Event: "Flood Warning"})
+
+	conf := publisherConfig(t, nws.URL().String())
+	conf.StorePath = filepath.Join(t.TempDir(), "alerts.jsonl")
+	sink := &batchSink{}
+	pub, err := noaalert.New(conf, sink)
+	require.NoError(t, err)
+	defer pub.Shutdown()
+
+	stats, err := pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.Acked)
+
+	// Only the alert issued since the last tick is published
+	nws.Issue(&noaalert.Alert{Event: "Tornado Warning"})
+	stats, err = pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.Acked)
+	require.Equal(t, []int{1, 1}, sink.batches())
+}
+
+func TestPublishUnidentified(t *testing.T) {
+	// Alerts without an ID or that cannot be decoded cannot be recorded as published.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.Write([]byte(`{"features":[{"properties":{"event":"Flood Warning"}},{"properties":{"id":"broken","sent":"yesterday"}}]}`))
+	}))
+	defer srv.Close()
+
+	sink := &batchSink{}
+	pub, err := noaalert.New(publisherConfig(t, srv.URL), sink)
+	require.NoError(t, err)
+	defer pub.Shutdown()
+
+	// The alerts are skipped on every tick rather than being published again
+	for i := 0; i < 2; i++ {
+		stats, err := pub.Publish(context.Background())
+		require.NoError(t, err)
+		require.Zero(t, stats.Published)
+	}
+	require.Empty(t, sink.batches())
+}
+
+// Returns the configuration of a publisher that polls the NWS at the base URL.
+func publisherConfig(t *testing.T, baseURL string) noaalert.Config {
+	conf, err := noaalert.Config{
+		Topic:          "noaa-alerts",
+		Interval:       5 * time.Minute,
+		AckTimeout:     time.Second,
+		PublishBackoff: time.Millisecond,
+		Weather:        noaalert.WeatherConfig{UserAgent: testUserAgent, BaseURL: baseURL},
+	}.Mark()
+	require.NoError(t, err)
+	return conf
+}
+
+func TestRunShutdown(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	issued := nws.Issue(nil)
+
+	conf := publisherConfig(t, nws.URL().String())
+	conf.Interval = 10 * time.Millisecond
+	conf.StorePath = filepath.Join(t.TempDir(), "alerts.jsonl")
+
+	sink := &slowSink{delay: 200 * time.Millisecond, sent: make(chan struct{}, 1)}
+	pub, err := noaalert.New(conf, sink)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- pub.Run()
+	}()
+
+	// Interrupt the publisher while the alert is waiting to be acked
+	select {
+	case <-sink.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the alert to be published")
+	}
+
+	proc, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, proc.Signal(os.Interrupt))
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the publisher to shut down")
+	}
+
+	// The sink is closed after the alert was acked and the alert was recorded
+	require.True(t, sink.closedAfterAck())
+	store, err := noaalert.OpenFileStore(conf.StorePath)
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = store.Get(issued.ID)
+	require.NoError(t, err, "acked alert should be recorded before the store is closed")
+}
+
+// A sink that acks alerts after a delay and records if it was closed before an ack.
+type slowSink struct {
+	mu     sync.Mutex
+	delay  time.Duration
+	sent   chan struct{}
+	acked  bool
+	closed bool
+	early  bool
+}
+
+func (s *slowSink) Name() string { return "slow" }
+
+func (s *slowSink) Publish(*noaalert.AlertEvent) (noaalert.Receipt, error) {
+	select {
+	case s.sent <- struct{}{}:
+	default:
+	}
+	return s, nil
+}
+
+func (s *slowSink) Wait(context.Context) error {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		s.early = true
+	}
+	s.acked = true
+	return nil
+}
+
+func (s *slowSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *slowSink) closedAfterAck() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed && s.acked && !s.early
+}
+
+func TestPublishDropped(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	nws.Issue(nil)
+
+	conf := publisherConfig(t, nws.URL().String())
+	conf.PublishRetries = 0
+	sink := &flakySink{failures: 1}
+	pub, err := noaalert.New(conf, sink)
+	require.NoError(t, err)
+	defer pub.Shutdown()
+
+	stats, err := pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.Dropped)
+
+	// The dropped alert is sent again even though the feed has not been modified
+	stats, err = pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.Acked)
+
+	stats, err = pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, stats.Published)
+}
+
+// A sink that fails to publish the first alerts it is sent, then acks every alert.
+type flakySink struct {
+	mu       sync.Mutex
+	failures int
+}
+
+func (s *flakySink) Name() string               { return "flaky" }
+func (s *flakySink) Close() error               { return nil }
+func (s *flakySink) Wait(context.Context) error { return nil }
+
+func (s *flakySink) Publish(*noaalert.AlertEvent) (noaalert.Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("sink unavailable")
+	}
+	return s, nil
+}
+
+func TestPublishUpdate(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	issued := nws.Issue(&noaalert.Alert{Event: "Flood Warning"})
+
+	sink := &recordSink{}
+	pub, err := noaalert.New(publisherConfig(t, nws.URL().String()), sink)
+	require.NoError(t, err)
+	defer pub.Shutdown()
+
+	_, err = pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{noaalert.AlertIssuedType.Name + ":" + issued.ID}, sink.published())
+
+	// The superseded alert is removed from the feed but it is updated, not expired
+	updated, err := nws.Update(issued.ID, nil)
+	require.NoError(t, err)
+
+	_, err = pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{noaalert.AlertUpdatedType.Name + ":" + updated.ID}, sink.published())
+}
+
+// A sink that acks every alert and records the alerts published since the last call to
+// published as the event type and alert ID.
+type recordSink struct {
+	mu     sync.Mutex
+	alerts []*noaalert.AlertEvent
+}
+
+func (s *recordSink) Name() string               { return "record" }
+func (s *recordSink) Close() error               { return nil }
+func (s *recordSink) Wait(context.Context) error { return nil }
+
+func (s *recordSink) Publish(alert *noaalert.AlertEvent) (noaalert.Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, alert)
+	return s, nil
+}
+
+func (s *recordSink) events() []*noaalert.AlertEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alerts := s.alerts
+	s.alerts = nil
+	return alerts
+}
+
+func (s *recordSink) published() []string {
+	events := s.events()
+	published := make([]string, 0, len(events))
+	for _, event := range events {
+		alert, _ := event.Alert()
+		published = append(published, event.EventType().Name+":"+alert.ID)
+	}
+	return published
+}
@@ -0,0 +1,129 @@
+package noaalert
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// WeatherOption configures the Weather client created by NewWeatherAPI.
+type WeatherOption func(api *Weather) error
+
+// WithUserAgent sets the User-Agent header sent with every request. The NWS asks that
+// the User-Agent identify the application and include contact information for the
+// operator, e.g. "(myweatherapp.com, contact@myweatherapp.com)".
+func WithUserAgent(userAgent string) WeatherOption {
+	return func(api *Weather) error {
+		if userAgent == "" {
+			return errors.New("user agent cannot be empty")
+		}
+		api.userAgent = userAgent
+		return nil
+	}
+}
+
+// WithBaseURL sets the URL of the NWS API, e.g. to use a mirror or a test server.
+func WithBaseURL(baseURL string) WeatherOption {
+	return func(api *Weather) (err error) {
+		var u *url.URL
+		if u, err = url.Parse(baseURL); err != nil {
+			return fmt.Errorf("could not parse base url: %w", err)
+		}
+
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("base url %q must be an absolute url", baseURL)
+		}
+
+		api.baseURL = u
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of each HTTP request made to the NWS API; a timeout of
+// zero means requests do not time out other than by their context.
+func WithTimeout(timeout time.Duration) WeatherOption {
+	return func(api *Weather) error {
+		if timeout < 0 {
+			return errors.New("timeout cannot be negative")
+		}
+		api.client.Timeout = timeout
+		return nil
+	}
+}
+
+// WithTransport sets the transport used to make requests to the NWS API.
+func WithTransport(transport http.RoundTripper) WeatherOption {
+	return func(api *Weather) error {
+		api.client.Transport = transport
+		return nil
+	}
+}
+
+// WithProxy makes requests to the NWS API through the specified proxy URL using a
+// clone of the default transport.
+func WithProxy(proxyURL string) WeatherOption {
+	return func(api *Weather) (err error) {
+		var u *url.URL
+		if u, err = url.Parse(proxyURL); err != nil {
+			return fmt.Errorf("could not parse proxy url: %w", err)
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(u)
+		api.client.Transport = transport
+		return nil
+	}
+}
+
+// WithAcceptLanguage sets the Accept-Language header sent with every request.
+func WithAcceptLanguage(lang string) WeatherOption {
+	return func(api *Weather) error {
+		if lang == "" {
+			return errors.New("accept language cannot be empty")
+		}
+		api.acceptLang = lang
+		return nil
+	}
+}
+
+// WithZoneCache persists the zone geometries fetched by ZoneGeometry to the directory,
+// creating it if necessary, so that they do not have to be fetched again on restart.
+func WithZoneCache(dir string) WeatherOption {
+	return func(api *Weather) (err error) {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("could not create zone cache: %w", err)
+		}
+		api.zoneCache = dir
+		return nil
+	}
+}
+
+// WithReplay serves recorded responses from a dump file or a directory of fixtures
+// instead of making requests to api.weather.gov. See NewReplay for details.
+func WithReplay(path string) WeatherOption {
+	return func(api *Weather) (err error) {
+		api.client.Transport, err = NewReplay(path)
+		return err
+	}
+}
+
+// WithRecorder captures every response from api.weather.gov to a directory of fixtures
+// that can later be served by WithReplay. The recorder wraps the transport configured
+// by any options specified before it.
+func WithRecorder(dir string) WeatherOption {
+	return func(api *Weather) (err error) {
+		api.client.Transport, err = NewRecorder(dir, transport(api.client))
+		return err
+	}
+}
+
+// Returns the transport of the client or the default transport if none is set.
+func transport(client *http.Client) http.RoundTripper {
+	if client.Transport != nil {
+		return client.Transport
+	}
+	return http.DefaultTransport
+}
@@ -0,0 +1,159 @@
+package noaalert
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// PageLimits caps the number of pages or features fetched by an AlertPager. A zero
+// value for either limit means the pager will continue until the results are exhausted.
+type PageLimits struct {
+	MaxPages    int
+	MaxFeatures int
+}
+
+// Paginate returns an iterator over the alerts at the specified api.weather.gov path
+// (e.g. "/alerts") that follows the pagination.next links in each response until all
+// results have been fetched or one of the limits is reached. Requests are made lazily
+// as the caller iterates over the alerts.
+func (s *Weather) Paginate(ctx context.Context, path string, query *AlertsQuery, limits PageLimits) *AlertPager {
+	var params url.Values
+	if query != nil {
+		if err := query.Validate(); err != nil {
+			return &AlertPager{err: err, done: true}
+		}
+		params = query.Values()
+	}
+	return s.paginate(ctx, path, params, limits)
+}
+
+// History returns an iterator over all alerts issued between the start and end times,
+// including alerts that are no longer active, from the api.weather.gov /alerts
+// endpoint. If the end time is zero then alerts up to the present are returned.
+func (s *Weather) History(ctx context.Context, start, end time.Time, query *AlertsQuery) *AlertPager {
+	if start.IsZero() {
+		return &AlertPager{err: fmt.Errorf("%w: a start time is required", ErrInvalidQuery), done: true}
+	}
+
+	if !end.IsZero() && !end.After(start) {
+		return &AlertPager{err: fmt.Errorf("%w: end time must be after start time", ErrInvalidQuery), done: true}
+	}
+
+	params := make(url.Values)
+	if query != nil {
+		if err := query.Validate(); err != nil {
+			return &AlertPager{err: err, done: true}
+		}
+		params = query.Values()
+	}
+
+	params.Set("start", start.UTC().Format(time.RFC3339))
+	if !end.IsZero() {
+		params.Set("end", end.UTC().Format(time.RFC3339))
+	}
+	return s.paginate(ctx, "/alerts", params, PageLimits{})
+}
+
+func (s *Weather) paginate(ctx context.Context, path string, params url.Values, limits PageLimits) *AlertPager {
+	pager := &AlertPager{api: s, ctx: ctx, limits: limits}
+	pager.next = s.baseURL.ResolveReference(&url.URL{Path: path})
+	pager.next.RawQuery = params.Encode()
+	return pager
+}
+
+// AlertPager iterates over the alerts in a paginated api.weather.gov response. Call
+// Next to advance the pager and Alert to get the current alert; once Next returns
+// false, check Error to determine if the pager stopped because of an error.
+type AlertPager struct {
+	api      *Weather
+	ctx      context.Context
+	limits   PageLimits
+	next     *url.URL
+	page     []*AlertEvent
+	current  *AlertEvent
+	pages    int
+	features int
+	err      error
+	done     bool
+}
+
+func (p *AlertPager) Next() bool {
+	if p.done {
+		return false
+	}
+
+	if p.limits.MaxFeatures > 0 && p.features >= p.limits.MaxFeatures {
+		p.done = true
+		return false
+	}
+
+	for len(p.page) == 0 {
+		if !p.fetch() {
+			p.done = true
+			return false
+		}
+	}
+
+	p.current, p.page = p.page[0], p.page[1:]
+	p.features++
+	return true
+}
+
+// Fetch the next page of alerts, returning false if there are no more pages.
+func (p *AlertPager) fetch() bool {
+	if p.next == nil {
+		return false
+	}
+
+	if p.limits.MaxPages > 0 && p.pages >= p.limits.MaxPages {
+		return false
+	}
+
+	var req *http.Request
+	if req, p.err = p.api.newRequest(p.ctx, http.MethodGet, p.next, nil); p.err != nil {
+		return false
+	}
+
+	var next string
+	if p.page, _, next, p.err = p.api.fetchAlerts(req); p.err != nil {
+		return false
+	}
+	p.pages++
+
+	// The NWS API returns a next link even on the last page, so an empty page means
+	// that all of the results have been fetched.
+	if len(p.page) == 0 || next == "" {
+		p.next = nil
+		return len(p.page) > 0
+	}
+
+	if p.next, p.err = url.Parse(next); p.err != nil {
+		return false
+	}
+	return true
+}
+
+func (p *AlertPager) Alert() *AlertEvent {
+	return p.current
+}
+
+func (p *AlertPager) Error() error {
+	return p.err
+}
+
+// Pages returns the number of pages that have been fetched so far.
+func (p *AlertPager) Pages() int {
+	return p.pages
+}
+
+// All collects the remaining alerts from the pager into a slice.
+func (p *AlertPager) All() (alerts []*AlertEvent, err error) {
+	alerts = make([]*AlertEvent, 0)
+	for p.Next() {
+		alerts = append(alerts, p.Alert())
+	}
+	return alerts, p.Error()
+}
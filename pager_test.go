@@ -0,0 +1,123 @@
+package noaalert_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/bbengfort/noaalert/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginate(t *testing.T) {
+	// Serve three pages of two alerts followed by an empty page with a next link.
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/alerts", r.URL.Path)
+		require.Equal(t, "KS", r.URL.Query().Get("area"))
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		features := ""
+		if page < 3 {
+			features = fmt.Sprintf(`{"properties":{"id":"alert-%d-a"}},{"properties":{"id":"alert-%d-b"}}`, page, page)
+		}
+
+		w.Header().Set("Content-Type", "application/geo+json")
+		fmt.Fprintf(w, `{"features":[%s],"pagination":{"next":"%s/alerts?area=KS&cursor=%d"}}`, features, srv.URL, page+1)
+	}))
+	defer srv.Close()
+
+	api, err := noaalert.NewWeatherAPI()
+	require.NoError(t, err)
+	u, _ := url.Parse(srv.URL)
+	api.SetBaseURL(u)
+
+	query := &noaalert.AlertsQuery{Area: []string{"KS"}}
+	testCases := []struct {
+		limits   noaalert.PageLimits
+		expected int
+		pages    int
+	}{
+		{noaalert.PageLimits{}, 6, 4},
+		{noaalert.PageLimits{MaxPages: 2}, 4, 2},
+		{noaalert.PageLimits{MaxFeatures: 3}, 3, 2},
+	}
+
+	for _, tc := range testCases {
+		pager := api.Paginate(context.Background(), "/alerts", query, tc.limits)
+		alerts, err := pager.All()
+		require.NoError(t, err)
+		require.Len(t, alerts, tc.expected)
+		require.Equal(t, tc.pages, pager.Pages())
+
+		rec, err := alerts[0].Record()
+		require.NoError(t, err)
+		require.Equal(t, "alert-0-a", rec.ID)
+	}
+
+	// An invalid query should stop the pager before any requests are made
+	pager := api.Paginate(context.Background(), "/alerts", &noaalert.AlertsQuery{Limit: -1}, noaalert.PageLimits{})
+	require.False(t, pager.Next())
+	require.ErrorIs(t, pager.Error(), noaalert.ErrInvalidQuery)
+}
+
+func TestHistory(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+
+	api, err := nws.Weather()
+	require.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	old := nws.Issue(&noaalert.Alert{Sent: now.Add(-3 * time.Hour), Expires: now.Add(-2 * time.Hour)})
+	recent := nws.Issue(&noaalert.Alert{Sent: now.Add(-2 * time.Hour)})
+	current := nws.Issue(&noaalert.Alert{Sent: now.Add(-30 * time.Minute)})
+
+	ids := func(alerts []*noaalert.AlertEvent) []string {
+		out := make([]string, 0, len(alerts))
+		for _, event := range alerts {
+			alert, err := event.Alert()
+			require.NoError(t, err)
+			out = append(out, alert.ID)
+		}
+		return out
+	}
+
+	// Only alerts sent within the window are returned, including expired alerts
+	alerts, err := api.History(context.Background(), now.Add(-4*time.Hour), now.Add(-time.Hour), nil).All()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{old.ID, recent.ID}, ids(alerts))
+
+	requests := nws.Requests()
+	params := requests[len(requests)-1].URL.Query()
+	require.Equal(t, now.Add(-4*time.Hour).Format(time.RFC3339), params.Get("start"))
+	require.Equal(t, now.Add(-time.Hour).Format(time.RFC3339), params.Get("end"))
+
+	// A zero end time returns all alerts up to the present, following every page
+	pager := api.History(context.Background(), now.Add(-150*time.Minute), time.Time{}, &noaalert.AlertsQuery{Limit: 1})
+	alerts, err = pager.All()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{recent.ID, current.ID}, ids(alerts))
+	require.Equal(t, 3, pager.Pages())
+
+	requests = nws.Requests()
+	params = requests[len(requests)-1].URL.Query()
+	require.NotEmpty(t, params.Get("start"))
+	require.Empty(t, params.Get("end"))
+	require.Equal(t, "1", params.Get("limit"))
+
+	// Invalid windows are rejected before any requests are made
+	nrequests := len(nws.Requests())
+	_, err = api.History(context.Background(), time.Time{}, now, nil).All()
+	require.ErrorIs(t, err, noaalert.ErrInvalidQuery)
+
+	_, err = api.History(context.Background(), now, now.Add(-time.Hour), nil).All()
+	require.ErrorIs(t, err, noaalert.ErrInvalidQuery)
+	require.Len(t, nws.Requests(), nrequests)
+}
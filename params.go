@@ -0,0 +1,158 @@
+package noaalert
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Maximum number of alerts that api.weather.gov will return in a single page.
+const maxAlertsLimit = 500
+
+// AlertsQuery maps to the query parameters of the api.weather.gov alerts endpoints so
+// that alerts can be filtered by the NWS rather than downloading the entire national
+// feed. Multiple values for a parameter are sent as a comma separated list. The area,
+// point, region, region type, and zone parameters are mutually exclusive.
+type AlertsQuery struct {
+	Area        []string // State/territory codes or marine area codes
+	Zone        []string // Zone IDs (forecast or county)
+	Point       string   // Latitude and longitude as "lat,lon"
+	Region      []string // Marine region codes (AL, AT, GL, GM, PA, PI)
+	RegionType  string   `split_words:"true"` // Either land or marine
+	Event       []string // Event names, e.g. "Flood Warning"
+	Severity    []string
+	Urgency     []string
+	Certainty   []string
+	Status      []string
+	MessageType []string `split_words:"true"`
+	Code        []string // Event codes, e.g. "FFW"
+	Limit       int      // Page size of the /alerts endpoint, ignored for active alerts
+}
+
+// IsZero returns true if no query parameters have been specified.
+func (q *AlertsQuery) IsZero() bool {
+	return q == nil || len(q.Values()) == 0
+}
+
+// Values returns the url query parameters to send to api.weather.gov.
+func (q *AlertsQuery) Values() url.Values {
+	params := make(url.Values)
+	if q == nil {
+		return params
+	}
+
+	set := func(key string, values []string) {
+		if len(values) > 0 {
+			params.Set(key, strings.Join(values, ","))
+		}
+	}
+
+	set("area", q.Area)
+	set("zone", q.Zone)
+	set("region", q.Region)
+	set("event", q.Event)
+	set("severity", mapStrings(q.Severity, capitalize))
+	set("urgency", mapStrings(q.Urgency, capitalize))
+	set("certainty", mapStrings(q.Certainty, capitalize))
+	set("status", mapStrings(q.Status, strings.ToLower))
+	set("message_type", mapStrings(q.MessageType, strings.ToLower))
+	set("code", q.Code)
+
+	if q.Point != "" {
+		params.Set("point", q.Point)
+	}
+
+	if q.RegionType != "" {
+		params.Set("region_type", q.RegionType)
+	}
+
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return params
+}
+
+// The NWS API expects CAP enumerations to be capitalized for severity, urgency, and
+// certainty but lower case for status and message type; accept either from users.
+func capitalize(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func mapStrings(values []string, fn func(string) string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, fn(v))
+	}
+	return out
+}
+
+// Validate the query parameters before sending them to api.weather.gov.
+func (q AlertsQuery) Validate() (err error) {
+	exclusive := 0
+	for _, set := range []bool{len(q.Area) > 0, len(q.Zone) > 0, q.Point != "", len(q.Region) > 0, q.RegionType != ""} {
+		if set {
+			exclusive++
+		}
+	}
+
+	if exclusive > 1 {
+		return fmt.Errorf("%w: area, zone, point, region, and region type are mutually exclusive", ErrInvalidQuery)
+	}
+
+	if q.Point != "" {
+		parts := strings.Split(q.Point, ",")
+		if len(parts) != 2 {
+			return fmt.Errorf("%w: point must be specified as lat,lon", ErrInvalidQuery)
+		}
+
+		for _, part := range parts {
+			if _, err = strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+				return fmt.Errorf("%w: could not parse point %q", ErrInvalidQuery, q.Point)
+			}
+		}
+	}
+
+	if q.RegionType != "" && q.RegionType != "land" && q.RegionType != "marine" {
+		return fmt.Errorf("%w: unknown region type %q", ErrInvalidQuery, q.RegionType)
+	}
+
+	for _, s := range q.Severity {
+		if !Severity(capitalize(s)).Valid() {
+			return fmt.Errorf("%w: unknown severity %q", ErrInvalidQuery, s)
+		}
+	}
+
+	for _, u := range q.Urgency {
+		if !Urgency(capitalize(u)).Valid() {
+			return fmt.Errorf("%w: unknown urgency %q", ErrInvalidQuery, u)
+		}
+	}
+
+	for _, c := range q.Certainty {
+		if !Certainty(capitalize(c)).Valid() {
+			return fmt.Errorf("%w: unknown certainty %q", ErrInvalidQuery, c)
+		}
+	}
+
+	for _, s := range q.Status {
+		if !Status(capitalize(s)).Valid() {
+			return fmt.Errorf("%w: unknown status %q", ErrInvalidQuery, s)
+		}
+	}
+
+	for _, m := range q.MessageType {
+		if !MessageType(capitalize(m)).Valid() {
+			return fmt.Errorf("%w: unknown message type %q", ErrInvalidQuery, m)
+		}
+	}
+
+	if q.Limit < 0 || q.Limit > maxAlertsLimit {
+		return fmt.Errorf("%w: limit must be between 0 and %d", ErrInvalidQuery, maxAlertsLimit)
+	}
+	return nil
+}
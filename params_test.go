@@ -0,0 +1,51 @@
+package noaalert_test
+
+import (
+	"testing"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertsQuery(t *testing.T) {
+	var query *noaalert.AlertsQuery
+	require.True(t, query.IsZero(), "nil query should be zero")
+
+	query = &noaalert.AlertsQuery{}
+	require.True(t, query.IsZero(), "empty query should be zero")
+	require.NoError(t, query.Validate())
+
+	query = &noaalert.AlertsQuery{
+		Area:        []string{"KS", "MO"},
+		Event:       []string{"Flood Warning"},
+		Severity:    []string{"severe", "EXTREME"},
+		Status:      []string{"Actual"},
+		MessageType: []string{"Alert", "update"},
+		Limit:       50,
+	}
+	require.False(t, query.IsZero())
+	require.NoError(t, query.Validate())
+	require.Equal(t, "area=KS%2CMO&event=Flood+Warning&limit=50&message_type=alert%2Cupdate&severity=Severe%2CExtreme&status=actual", query.Values().Encode())
+
+	testCases := []struct {
+		query noaalert.AlertsQuery
+		err   string
+	}{
+		{noaalert.AlertsQuery{Area: []string{"KS"}, Zone: []string{"KSZ001"}}, "area, zone, point, region, and region type are mutually exclusive"},
+		{noaalert.AlertsQuery{Point: "39.7456"}, "point must be specified as lat,lon"},
+		{noaalert.AlertsQuery{Point: "39.7456,north"}, `could not parse point "39.7456,north"`},
+		{noaalert.AlertsQuery{RegionType: "air"}, `unknown region type "air"`},
+		{noaalert.AlertsQuery{Severity: []string{"bad"}}, `unknown severity "bad"`},
+		{noaalert.AlertsQuery{Urgency: []string{"now"}}, `unknown urgency "now"`},
+		{noaalert.AlertsQuery{Certainty: []string{"maybe"}}, `unknown certainty "maybe"`},
+		{noaalert.AlertsQuery{Status: []string{"real"}}, `unknown status "real"`},
+		{noaalert.AlertsQuery{MessageType: []string{"notice"}}, `unknown message type "notice"`},
+		{noaalert.AlertsQuery{Limit: 1000}, "limit must be between 0 and 500"},
+	}
+
+	for _, tc := range testCases {
+		err := tc.query.Validate()
+		require.ErrorIs(t, err, noaalert.ErrInvalidQuery)
+		require.EqualError(t, err, "invalid alerts query: "+tc.err)
+	}
+}
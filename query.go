@@ -11,11 +11,15 @@ import (
 )
 
 func Query(client *ensign.Client, offset, limit int) (_ *AlertIterator, err error) {
+	return queryTopic(client, "noaa-alerts", offset, limit)
+}
+
+func queryTopic(client *ensign.Client, topic string, offset, limit int) (_ *AlertIterator, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
 	var cursor *ensign.QueryCursor
-	if cursor, err = client.EnSQL(ctx, &api.Query{Query: fmt.Sprintf("SELECT * FROM noaa-alerts OFFSET %d LIMIT %d", offset, limit)}); err != nil {
+	if cursor, err = client.EnSQL(ctx, &api.Query{Query: fmt.Sprintf("SELECT * FROM %s OFFSET %d LIMIT %d", topic, offset, limit)}); err != nil {
 		return nil, err
 	}
 
@@ -43,15 +47,7 @@ func (a *AlertIterator) Next() bool {
 		return false
 	}
 
-	a.current = &AlertEvent{
-		CorrelationID: event.Metadata["correlation_id"],
-		RequestID:     event.Metadata["request_id"],
-		ServerID:      event.Metadata["server_id"],
-		LastModified:  event.Metadata["last_modified"],
-		Expires:       event.Metadata["expires"],
-		Data:          event.Data,
-	}
-
+	a.current = newAlertEvent(event)
 	return true
 }
 
@@ -0,0 +1,158 @@
+package noaalert
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Replay is an http.RoundTripper that serves recorded HTTP responses instead of making
+// requests to api.weather.gov so that the Weather client can be used without network
+// access. Responses are raw HTTP response dumps, optionally gzip compressed, such as
+// testdata/response.txt.gz or the fixtures written by a Recorder.
+type Replay struct {
+	path string
+	dump []byte
+}
+
+var _ http.RoundTripper = &Replay{}
+
+// NewReplay creates a replay transport from a path. If the path is a file then the
+// recorded response is served for every request; if the path is a directory then each
+// request is served the fixture named by FixtureName, and a 404 problem is returned if
+// no fixture has been recorded for the request.
+func NewReplay(path string) (_ *Replay, err error) {
+	var info os.FileInfo
+	if info, err = os.Stat(path); err != nil {
+		return nil, fmt.Errorf("could not open replay fixtures: %w", err)
+	}
+
+	replay := &Replay{path: path}
+	if !info.IsDir() {
+		if replay.dump, err = readDump(path); err != nil {
+			return nil, err
+		}
+	}
+	return replay, nil
+}
+
+func (r *Replay) RoundTrip(req *http.Request) (_ *http.Response, err error) {
+	dump := r.dump
+	if dump == nil {
+		name := filepath.Join(r.path, FixtureName(req))
+		if dump, err = readDump(name); err != nil {
+			if dump, err = readDump(name + ".gz"); err != nil {
+				return notRecorded(req), nil
+			}
+		}
+	}
+
+	var rep *http.Response
+	if rep, err = http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), req); err != nil {
+		return nil, fmt.Errorf("could not parse recorded response: %w", err)
+	}
+	return rep, nil
+}
+
+// Recorder is an http.RoundTripper that captures the responses from another transport
+// to a directory of fixtures that can be served by Replay.
+type Recorder struct {
+	dir       string
+	transport http.RoundTripper
+}
+
+var _ http.RoundTripper = &Recorder{}
+
+// NewRecorder creates a recorder that writes fixtures to the directory, creating it if
+// necessary. If transport is nil then http.DefaultTransport is used.
+func NewRecorder(dir string, transport http.RoundTripper) (_ *Recorder, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create recorder directory: %w", err)
+	}
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{dir: dir, transport: transport}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (rep *http.Response, err error) {
+	if rep, err = r.transport.RoundTrip(req); err != nil {
+		return nil, err
+	}
+
+	// DumpResponse replaces the body so the response can still be read by the caller.
+	var dump []byte
+	if dump, err = httputil.DumpResponse(rep, true); err != nil {
+		rep.Body.Close()
+		return nil, fmt.Errorf("could not record response: %w", err)
+	}
+
+	if err = os.WriteFile(filepath.Join(r.dir, FixtureName(req)), dump, 0644); err != nil {
+		rep.Body.Close()
+		return nil, fmt.Errorf("could not record response: %w", err)
+	}
+	return rep, nil
+}
+
+// FixtureName returns the file name of the recorded response for the request, keyed by
+// the method, path, and query. The query is hashed to keep the name a reasonable size.
+func FixtureName(req *http.Request) string {
+	path := strings.Trim(req.URL.Path, "/")
+	path = strings.NewReplacer("/", "-", ":", "_").Replace(path)
+	if path == "" {
+		path = "index"
+	}
+
+	name := req.Method + "-" + path
+	if query := req.URL.Query().Encode(); query != "" {
+		sum := sha256.Sum256([]byte(query))
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+	return name + ".txt"
+}
+
+// Read a response dump from disk, decompressing it if it was gzipped.
+func readDump(path string) (_ []byte, err error) {
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	if magic, _ := reader.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(reader); err != nil {
+			return nil, fmt.Errorf("could not decompress recorded response: %w", err)
+		}
+		defer gz.Close()
+		return io.ReadAll(gz)
+	}
+	return io.ReadAll(reader)
+}
+
+// Returns a 404 problem response for a request that has no recorded fixture.
+func notRecorded(req *http.Request) *http.Response {
+	body := fmt.Sprintf(`{"title":"Not Found","status":404,"detail":"no recorded response for %s %s"}`, req.Method, req.URL.RequestURI())
+	return &http.Response{
+		Status:        "404 Not Found",
+		StatusCode:    http.StatusNotFound,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{problemJSON}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,118 @@
+package noaalert_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	api, err := noaalert.NewWeatherAPI(noaalert.WithReplay("testdata/response.txt.gz"))
+	require.NoError(t, err, "could not create weather api with replay")
+
+	alerts, err := api.Alerts(context.Background(), nil)
+	require.NoError(t, err, "could not fetch recorded alerts")
+	require.Len(t, alerts, 374)
+
+	require.Equal(t, "45d6d42e", alerts[0].CorrelationID)
+	require.Equal(t, "106b93c1-d80f-4c15-8399-83c70eb21543", alerts[0].RequestID)
+	require.Equal(t, "vm-bldr-nids-apiapp3.ncep.noaa.gov", alerts[0].ServerID)
+	require.Equal(t, "Thu, 03 Aug 2023 19:20:03 GMT", alerts[0].LastModified)
+	require.Equal(t, "Thu, 03 Aug 2023 19:20:55 GMT", alerts[0].Expires)
+
+	headline, err := alerts[0].Headline()
+	require.NoError(t, err)
+	require.Equal(t, "Coastal Flood Statement issued August 3 at 3:19PM EDT until August 4 at 3:00AM EDT by NWS Boston/Norton MA", headline)
+
+	_, err = noaalert.NewWeatherAPI(noaalert.WithReplay("testdata/missing.txt"))
+	require.Error(t, err, "should not be able to replay a missing fixture")
+}
+
+func TestReplayPublisher(t *testing.T) {
+	conf, err := noaalert.Config{
+		Topic:          "noaa-alerts",
+		Interval:       5 * time.Minute,
+		StorePath:      filepath.Join(t.TempDir(), "alerts.jsonl"),
+		StoreRetention: time.Hour,
+		AckTimeout:     time.Second,
+		PublishBackoff: time.Millisecond,
+		Weather:        noaalert.WeatherConfig{UserAgent: testUserAgent, Replay: "testdata/response.txt.gz"},
+	}.Mark()
+	require.NoError(t, err)
+
+	sink := &batchSink{}
+	pub, err := noaalert.New(conf, sink)
+	require.NoError(t, err)
+
+	stats, err := pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(374), stats.Acked)
+
+	// The same alerts are replayed on the next tick and are not published again
+	stats, err = pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, stats.Published)
+	require.NoError(t, pub.Shutdown())
+
+	// Nor are they published by a publisher that is restarted with the same store
+	pub, err = noaalert.New(conf, sink)
+	require.NoError(t, err)
+	defer pub.Shutdown()
+
+	stats, err = pub.Publish(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, stats.Published)
+	require.Equal(t, []int{374}, sink.batches())
+}
+
+func TestRecorder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.Header().Set("X-Correlation-Id", r.URL.Query().Get("area"))
+		w.Write([]byte(`{"features":[{"properties":{"id":"alert-` + r.URL.Query().Get("area") + `"}}]}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	// Record responses from the server for several different queries
+	fixtures := t.TempDir()
+	recorder, err := noaalert.NewWeatherAPI(noaalert.WithRecorder(fixtures))
+	require.NoError(t, err)
+	recorder.SetBaseURL(u)
+
+	for _, area := range []string{"MA", "KS"} {
+		alerts, err := recorder.Alerts(context.Background(), &noaalert.AlertsQuery{Area: []string{area}})
+		require.NoError(t, err)
+		require.Len(t, alerts, 1)
+	}
+
+	// Replay the responses from the fixtures directory after the server is gone
+	srv.Close()
+	replay, err := noaalert.NewWeatherAPI(noaalert.WithReplay(fixtures))
+	require.NoError(t, err)
+	replay.SetBaseURL(u)
+
+	for _, area := range []string{"MA", "KS"} {
+		alerts, err := replay.Alerts(context.Background(), &noaalert.AlertsQuery{Area: []string{area}})
+		require.NoError(t, err)
+		require.Len(t, alerts, 1)
+		require.Equal(t, area, alerts[0].CorrelationID)
+
+		rec, err := alerts[0].Record()
+		require.NoError(t, err)
+		require.Equal(t, "alert-"+area, rec.ID)
+	}
+
+	// A request that was not recorded should return a not found error
+	_, err = replay.Alerts(context.Background(), &noaalert.AlertsQuery{Area: []string{"NH"}})
+	target := &noaalert.APIError{}
+	require.ErrorAs(t, err, &target)
+	require.True(t, target.NotFound())
+}
@@ -0,0 +1,133 @@
+package noaalert
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy determines how Weather retries failed requests to api.weather.gov. Only
+// idempotent requests are retried, and only after network errors or responses with a
+// 429, 500, 502, 503, or 504 status. The delay between attempts grows exponentially
+// from the base delay up to the max delay unless the server specifies a Retry-After.
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts including the first; 1 or less disables retries
+	BaseDelay   time.Duration // Delay before the first retry, doubled on every attempt
+	MaxDelay    time.Duration // Maximum delay between attempts, including Retry-After
+	Jitter      float64       // Fraction of the delay randomly added or subtracted
+}
+
+// DefaultRetryPolicy is used by NewWeatherAPI unless another policy is specified.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Jitter:      0.2,
+}
+
+// NoRetries disables retries so that requests fail on the first error.
+var NoRetries = RetryPolicy{MaxAttempts: 1}
+
+// SetRetryPolicy changes the retry policy used for all subsequent requests.
+func (s *Weather) SetRetryPolicy(policy RetryPolicy) {
+	s.mu.Lock()
+	s.retries = policy
+	s.mu.Unlock()
+}
+
+func (s *Weather) retryPolicy() RetryPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.retries
+}
+
+// Retryable returns true if the request may be retried after the response or error.
+func (p RetryPolicy) Retryable(req *http.Request, rep *http.Response, err error) bool {
+	if !idempotent(req.Method) {
+		return false
+	}
+
+	// Requests with a body can only be retried if the body can be recreated.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		// Do not retry if the caller has cancelled the request or its deadline passed.
+		return req.Context().Err() == nil
+	}
+
+	switch rep.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Delay returns the backoff before the specified retry attempt (starting at 1), with
+// jitter applied. If the response has a Retry-After header then its value is used
+// instead; ok is false if the server asked to wait longer than the max delay.
+func (p RetryPolicy) Delay(attempt int, rep *http.Response) (delay time.Duration, ok bool) {
+	if rep != nil {
+		if after, set := retryAfter(rep); set {
+			return after, after <= p.MaxDelay
+		}
+	}
+
+	delay = p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+	return delay, true
+}
+
+// Parse the Retry-After header as either a number of seconds or an HTTP date.
+func retryAfter(rep *http.Response) (time.Duration, bool) {
+	header := rep.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		if after := time.Until(date); after > 0 {
+			return after, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Wait for the delay or until the context is done.
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+package noaalert
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Scheduler determines how long the publisher waits before polling NOAA again. The
+// delay speeds up toward the minimum interval while new alerts are appearing, relaxes
+// back to the base interval when the feed is quiet, and backs off exponentially toward
+// the maximum interval when requests fail. The delay is never shorter than the time
+// until the previous response expires according to the NOAA cache headers, and jitter
+// is added so that multiple deployments do not poll NOAA in lockstep.
+type Scheduler struct {
+	mu       sync.Mutex
+	base     time.Duration
+	min      time.Duration
+	max      time.Duration
+	jitter   float64
+	interval time.Duration
+	backoff  time.Duration
+	rand     *rand.Rand
+}
+
+// PollResult describes the outcome of polling NOAA for alerts.
+type PollResult struct {
+	Err       error     // Any error that occurred fetching or publishing alerts
+	NewAlerts int       // The number of new or changed alerts in the response
+	Expires   time.Time // When the response expires according to the cache headers
+}
+
+// NewScheduler creates a scheduler that starts at the base interval, bounded by min
+// and max. Jitter is the fraction of the delay that is randomly added or subtracted.
+func NewScheduler(base, min, max time.Duration, jitter float64) *Scheduler {
+	if min <= 0 || min > base {
+		min = base
+	}
+
+	if max < base {
+		max = base
+	}
+
+	return &Scheduler{
+		base:     base,
+		min:      min,
+		max:      max,
+		jitter:   jitter,
+		interval: base,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Next returns the delay until the next poll given the result of the previous poll.
+func (s *Scheduler) Next(res PollResult) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var delay time.Duration
+	switch {
+	case res.Err != nil:
+		if s.backoff == 0 {
+			s.backoff = s.interval
+		}
+		s.backoff = clamp(s.backoff*2, s.min, s.max)
+		delay = s.backoff
+	case res.NewAlerts > 0:
+		s.backoff = 0
+		s.interval = clamp(s.interval/2, s.min, s.max)
+		delay = s.interval
+	default:
+		s.backoff = 0
+		if s.interval < s.base {
+			s.interval = clamp(s.interval*2, s.min, s.base)
+		}
+		delay = s.interval
+	}
+
+	// Do not poll before the previous response has expired
+	if !res.Expires.IsZero() {
+		if fresh := time.Until(res.Expires); fresh > delay {
+			delay = clamp(fresh, s.min, s.max)
+		}
+	}
+
+	if s.jitter > 0 {
+		delay += time.Duration((s.rand.Float64()*2 - 1) * s.jitter * float64(delay))
+	}
+	return delay
+}
+
+// Interval returns the current polling interval without backoff or jitter.
+func (s *Scheduler) Interval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval
+}
+
+func clamp(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
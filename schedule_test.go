@@ -0,0 +1,48 @@
+package noaalert_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler(t *testing.T) {
+	sched := noaalert.NewScheduler(4*time.Minute, time.Minute, 16*time.Minute, 0)
+	require.Equal(t, 4*time.Minute, sched.Interval())
+
+	// New alerts should speed up polling until the minimum interval
+	require.Equal(t, 2*time.Minute, sched.Next(noaalert.PollResult{NewAlerts: 3}))
+	require.Equal(t, time.Minute, sched.Next(noaalert.PollResult{NewAlerts: 1}))
+	require.Equal(t, time.Minute, sched.Next(noaalert.PollResult{NewAlerts: 1}))
+
+	// Quiet polls should relax back to the base interval
+	require.Equal(t, 2*time.Minute, sched.Next(noaalert.PollResult{}))
+	require.Equal(t, 4*time.Minute, sched.Next(noaalert.PollResult{}))
+	require.Equal(t, 4*time.Minute, sched.Next(noaalert.PollResult{}))
+
+	// Errors should back off exponentially until the maximum interval
+	err := errors.New("service unavailable")
+	require.Equal(t, 8*time.Minute, sched.Next(noaalert.PollResult{Err: err}))
+	require.Equal(t, 16*time.Minute, sched.Next(noaalert.PollResult{Err: err}))
+	require.Equal(t, 16*time.Minute, sched.Next(noaalert.PollResult{Err: err}))
+	require.Equal(t, 4*time.Minute, sched.Next(noaalert.PollResult{}), "backoff should reset on success")
+
+	// The expiration of the response should be a floor on the delay
+	delay := sched.Next(noaalert.PollResult{Expires: time.Now().Add(10 * time.Minute)})
+	require.InDelta(t, 10*time.Minute, delay, float64(time.Second))
+
+	delay = sched.Next(noaalert.PollResult{Expires: time.Now().Add(time.Hour)})
+	require.Equal(t, 16*time.Minute, delay, "expiration should not exceed the maximum interval")
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	sched := noaalert.NewScheduler(10*time.Minute, time.Minute, time.Hour, 0.1)
+	for i := 0; i < 100; i++ {
+		delay := sched.Next(noaalert.PollResult{})
+		require.GreaterOrEqual(t, delay, 9*time.Minute)
+		require.LessOrEqual(t, delay, 11*time.Minute)
+	}
+}
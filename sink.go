@@ -0,0 +1,388 @@
+package noaalert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sdk "github.com/rotationalio/go-ensign"
+)
+
+// Names of the built-in sinks that can be configured as publisher destinations.
+const (
+	SinkEnsign  = "ensign"
+	SinkStdout  = "stdout"
+	SinkFile    = "file"
+	SinkWebhook = "webhook"
+)
+
+// Sink is a destination that the Publisher sends alert events to. Publish sends the
+// event and returns a Receipt that is used to wait for the destination to acknowledge
+// it; an error from Publish or the Receipt causes the event to be retried.
+type Sink interface {
+	Name() string
+	Publish(alert *AlertEvent) (Receipt, error)
+	Close() error
+}
+
+// Receipt waits for an event sent to a Sink to be acknowledged. Wait returns nil if
+// the event was acked, an error wrapping ErrNacked if it was rejected, or ErrAckTimeout
+// if the context is done before the event is acknowledged.
+type Receipt interface {
+	Wait(ctx context.Context) error
+}
+
+// A receipt for sinks that know the outcome as soon as the event is sent.
+type receipt struct {
+	err error
+}
+
+func (r receipt) Wait(context.Context) error {
+	return r.err
+}
+
+// Open the sinks configured as the destinations of the publisher.
+func openSinks(conf Config) (sinks []Sink, err error) {
+	sinks = make([]Sink, 0, len(conf.Sinks))
+	for _, name := range conf.Sinks {
+		var sink Sink
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case SinkEnsign:
+			sink, err = NewEnsignSink(conf)
+		case SinkStdout:
+			sink = NewWriterSink(SinkStdout, os.Stdout)
+		case SinkFile:
+			sink, err = OpenFileSink(conf.FileSink.Path, conf.FileSink.MaxSize, conf.FileSink.MaxBackups)
+		case SinkWebhook:
+			sink = NewWebhookSink(conf.Webhook.URL, conf.Webhook.Timeout, conf.Webhook.Headers)
+		default:
+			err = fmt.Errorf("%w: unknown sink %q", ErrInvalidSink, name)
+		}
+
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// The JSON representation of an alert event written by the stdout, file, and webhook
+// sinks; the data is the GeoJSON feature of the alert.
+type sinkEvent struct {
+	Type      string            `json:"type"`
+	Mimetype  string            `json:"mimetype"`
+	Metadata  map[string]string `json:"metadata"`
+	Data      json.RawMessage   `json:"data"`
+	Published time.Time         `json:"published"`
+}
+
+func marshalEvent(alert *AlertEvent) ([]byte, error) {
+	event := alert.Event()
+	return json.Marshal(&sinkEvent{
+		Type:      event.Type.Name,
+		Mimetype:  event.Mimetype.MimeType(),
+		Metadata:  event.Metadata,
+		Data:      event.Data,
+		Published: time.Now().UTC(),
+	})
+}
+
+//===========================================================================
+// Ensign Sink
+//===========================================================================
+
+// EnsignSink publishes alerts to the configured Ensign topic.
+type EnsignSink struct {
+	client *sdk.Client
+	topic  string
+}
+
+var _ Sink = &EnsignSink{}
+
+// NewEnsignSink connects to Ensign and ensures the topic exists if configured to. Any
+// additional options, e.g. to connect to a mock, are applied after the configuration.
+func NewEnsignSink(conf Config, opts ...sdk.Option) (sink *EnsignSink, err error) {
+	sink = &EnsignSink{topic: conf.Topic}
+	if sink.client, err = sdk.New(append(conf.Ensign.Options(), opts...)...); err != nil {
+		return nil, err
+	}
+
+	if conf.EnsureTopicExists {
+		if err = EnsureTopicExists(sink.client, conf.Topic); err != nil {
+			sink.client.Close()
+			return nil, err
+		}
+	}
+	return sink, nil
+}
+
+func (s *EnsignSink) Name() string {
+	return SinkEnsign
+}
+
+func (s *EnsignSink) Publish(alert *AlertEvent) (_ Receipt, err error) {
+	event := alert.Event()
+	if err = s.client.Publish(s.topic, event); err != nil {
+		return nil, err
+	}
+	return &ensignReceipt{event: event}, nil
+}
+
+func (s *EnsignSink) Close() error {
+	return s.client.Close()
+}
+
+// Waits for Ensign to ack or nack the published event.
+type ensignReceipt struct {
+	event *sdk.Event
+}
+
+func (r *ensignReceipt) Wait(ctx context.Context) error {
+	return waitForAck(ctx, r.event)
+}
+
+//===========================================================================
+// Writer Sink
+//===========================================================================
+
+// WriterSink writes alerts as JSON lines to a writer such as stdout.
+type WriterSink struct {
+	mu   sync.Mutex
+	name string
+	out  io.Writer
+}
+
+var _ Sink = &WriterSink{}
+
+func NewWriterSink(name string, out io.Writer) *WriterSink {
+	return &WriterSink{name: name, out: out}
+}
+
+func (s *WriterSink) Name() string {
+	return s.name
+}
+
+func (s *WriterSink) Publish(alert *AlertEvent) (_ Receipt, err error) {
+	var data []byte
+	if data, err = marshalEvent(alert); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.out.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	return receipt{}, nil
+}
+
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+//===========================================================================
+// File Sink
+//===========================================================================
+
+// FileSink appends alerts as JSON lines to a local file. When the file exceeds the
+// maximum size it is renamed with a timestamp suffix and a new file is started; only
+// the most recent backups are kept.
+type FileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+var _ Sink = &FileSink{}
+
+// OpenFileSink opens the file for appending, creating it and its directory if needed.
+// A maxSize of zero disables rotation and a maxBackups of zero keeps all backups.
+func OpenFileSink(path string, maxSize int64, maxBackups int) (sink *FileSink, err error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: file sink requires a path", ErrInvalidSink)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("could not create file sink directory: %w", err)
+	}
+
+	sink = &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err = sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *FileSink) Name() string {
+	return SinkFile
+}
+
+func (s *FileSink) Publish(alert *AlertEvent) (_ Receipt, err error) {
+	var data []byte
+	if data, err = marshalEvent(alert); err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil, ErrSinkClosed
+	}
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(data)) > s.maxSize {
+		if err = s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var n int
+	n, err = s.file.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		return nil, fmt.Errorf("could not write to file sink: %w", err)
+	}
+	return receipt{}, nil
+}
+
+func (s *FileSink) Close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		err = s.file.Close()
+		s.file = nil
+	}
+	return err
+}
+
+func (s *FileSink) open() (err error) {
+	if s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return fmt.Errorf("could not open file sink: %w", err)
+	}
+
+	var info os.FileInfo
+	if info, err = s.file.Stat(); err != nil {
+		return err
+	}
+	s.size = info.Size()
+	return nil
+}
+
+// Rename the current file to a backup and open a new file. Must hold the lock.
+func (s *FileSink) rotate() (err error) {
+	if err = s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	ext := filepath.Ext(s.path)
+	base := strings.TrimSuffix(s.path, ext)
+	backup := s.backupPath(base, ext, time.Now().UTC())
+	if err = os.Rename(s.path, backup); err != nil {
+		return fmt.Errorf("could not rotate file sink: %w", err)
+	}
+
+	if s.maxBackups > 0 {
+		// Backup names sort chronologically because of the timestamp format.
+		backups, _ := filepath.Glob(base + "-*" + ext)
+		sort.Strings(backups)
+		for len(backups) > s.maxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+	return s.open()
+}
+
+// Returns a backup path that does not already exist so that rotating more than once in
+// the same instant does not overwrite an earlier backup.
+func (s *FileSink) backupPath(base, ext string, ts time.Time) string {
+	for {
+		backup := fmt.Sprintf("%s-%s%s", base, ts.Format("20060102T150405.000000000"), ext)
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			return backup
+		}
+		ts = ts.Add(time.Nanosecond)
+	}
+}
+
+//===========================================================================
+// Webhook Sink
+//===========================================================================
+
+// WebhookSink posts each alert as JSON to an HTTP endpoint. The alert is acked if the
+// endpoint responds with a 2xx status and nacked otherwise. Requests identify noaalert
+// and its version, not the operator contact sent to the NWS, unless the User-Agent is
+// set in the headers.
+type WebhookSink struct {
+	url     string
+	client  *http.Client
+	headers map[string]string
+}
+
+var _ Sink = &WebhookSink{}
+
+func NewWebhookSink(url string, timeout time.Duration, headers map[string]string) *WebhookSink {
+	return &WebhookSink{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		headers: headers,
+	}
+}
+
+func (s *WebhookSink) Name() string {
+	return SinkWebhook
+}
+
+func (s *WebhookSink) Publish(alert *AlertEvent) (_ Receipt, err error) {
+	var data []byte
+	if data, err = marshalEvent(alert); err != nil {
+		return nil, err
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequest(http.MethodPost, s.url, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("could not create webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "noaalert/"+Version())
+	for key, val := range s.headers {
+		req.Header.Set(key, val)
+	}
+
+	var rep *http.Response
+	if rep, err = s.client.Do(req); err != nil {
+		return nil, fmt.Errorf("could not post to webhook: %w", err)
+	}
+	defer rep.Body.Close()
+	io.Copy(io.Discard, rep.Body)
+
+	if rep.StatusCode < 200 || rep.StatusCode >= 300 {
+		return receipt{err: fmt.Errorf("%w: webhook responded %s", ErrNacked, rep.Status)}, nil
+	}
+	return receipt{}, nil
+}
+
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
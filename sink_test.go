@@ -0,0 +1,141 @@
+package noaalert_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/bbengfort/noaalert/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := noaalert.NewWriterSink("stdout", buf)
+
+	receipt, err := sink.Publish(alertEvent(t, &noaalert.Alert{ID: "alert-1", MessageType: noaalert.MessageTypeAlert}))
+	require.NoError(t, err)
+	require.NoError(t, receipt.Wait(context.Background()))
+
+	event := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &event))
+	require.Equal(t, "AlertIssued", event["type"])
+	require.Equal(t, "alert-1", event["metadata"].(map[string]interface{})["alert_id"])
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sink", "alerts.jsonl")
+	sink, err := noaalert.OpenFileSink(path, 2048, 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err = sink.Publish(alertEvent(t, &noaalert.Alert{ID: "alert", Description: strings.Repeat("x", 100)}))
+		require.NoError(t, err)
+	}
+	require.NoError(t, sink.Close())
+
+	_, err = sink.Publish(alertEvent(t, &noaalert.Alert{ID: "alert"}))
+	require.ErrorIs(t, err, noaalert.ErrSinkClosed)
+
+	// Only the configured number of backups should be kept
+	backups, err := filepath.Glob(filepath.Join(filepath.Dir(path), "alerts-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.LessOrEqual(t, info.Size(), int64(2048))
+}
+
+func TestWebhookSink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "secret", r.Header.Get("Authorization"))
+		require.Equal(t, "noaalert/"+noaalert.Version(), r.Header.Get("User-Agent"))
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	headers := map[string]string{"Authorization": "secret"}
+	sink := noaalert.NewWebhookSink(srv.URL, time.Second, headers)
+	receipt, err := sink.Publish(alertEvent(t, &noaalert.Alert{ID: "alert-1"}))
+	require.NoError(t, err)
+	require.NoError(t, receipt.Wait(context.Background()))
+
+	sink = noaalert.NewWebhookSink(srv.URL+"/fail", time.Second, headers)
+	receipt, err = sink.Publish(alertEvent(t, &noaalert.Alert{ID: "alert-1"}))
+	require.NoError(t, err)
+	require.ErrorIs(t, receipt.Wait(context.Background()), noaalert.ErrNacked)
+}
+
+func TestPublisherSinks(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	nws.Issue(&noaalert.Alert{Event: "Flood Warning"})
+	nws.Issue(&noaalert.Alert{Event: "Heat Advisory"})
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer webhook.Close()
+
+	conf, err := noaalert.Config{
+		Topic:          "noaa-alerts",
+		Interval:       5 * time.Minute,
+		StorePath:      filepath.Join(t.TempDir(), "alerts.jsonl"),
+		AckTimeout:     time.Second,
+		PublishRetries: 1,
+		PublishBackoff: time.Millisecond,
+		Weather:        noaalert.WeatherConfig{UserAgent: testUserAgent, BaseURL: nws.URL().String()},
+	}.Mark()
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	stdout := noaalert.NewWriterSink("stdout", out)
+	pub, err := noaalert.New(conf, stdout, noaalert.NewWebhookSink(webhook.URL, time.Second, nil))
+	require.NoError(t, err)
+	defer pub.Shutdown()
+
+	start := time.Now().Add(-time.Hour)
+	stats, err := pub.Backfill(context.Background(), start, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), stats.Acked, "the stdout sink should ack both alerts")
+	require.Equal(t, uint64(2), stats.Dropped, "the webhook sink should drop both alerts")
+	require.Len(t, pub.Failures(), 2)
+	require.Equal(t, "webhook", pub.Failures()[0].Sink)
+
+	lines := 0
+	for scanner := bufio.NewScanner(out); scanner.Scan(); {
+		lines++
+	}
+	require.Equal(t, 2, lines)
+
+	// Alerts that were not acked by every sink are sent again
+	stats, err = pub.Backfill(context.Background(), start, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), stats.Acked)
+
+	// Once every sink acks the alerts they are not published again
+	conf.StorePath = filepath.Join(t.TempDir(), "alerts.jsonl")
+	pub, err = noaalert.New(conf, stdout)
+	require.NoError(t, err)
+	stats, err = pub.Backfill(context.Background(), start, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), stats.Acked)
+
+	stats, err = pub.Backfill(context.Background(), start, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, stats.Published)
+}
@@ -0,0 +1,340 @@
+package noaalert
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store keeps track of the NOAA alerts that have already been published so that the
+// Publisher only sends new or changed alerts to Ensign on every interval tick.
+type Store interface {
+	// Get returns the record for the specified alert ID or ErrNotFound.
+	Get(id string) (*Record, error)
+
+	// Put creates or replaces the record for the alert.
+	Put(rec *Record) error
+
+	// Delete removes the record for the alert if it exists.
+	Delete(id string) error
+
+	// Prune removes all records that expired before the specified timestamp.
+	Prune(before time.Time) (int, error)
+
+	// Active returns the records of alerts that have not yet expired or been superseded.
+	Active() ([]*Record, error)
+
+	// Close the store, flushing any remaining data to disk if necessary.
+	Close() error
+}
+
+// Record identifies a version of an alert that has been published. An alert is new
+// if its ID has not been seen before and changed if its sent or updated timestamps
+// differ from the previously published version. An alert is active until it expires,
+// is removed from the NWS feed, or is superseded by an update or cancellation.
+type Record struct {
+	ID       string          `json:"id"`
+	Sent     string          `json:"sent"`
+	Updated  string          `json:"updated,omitempty"`
+	Expires  time.Time       `json:"expires,omitempty"`
+	Ends     time.Time       `json:"ends,omitempty"`
+	Seen     time.Time       `json:"seen"`
+	Headline string          `json:"headline,omitempty"`
+	Alert    json.RawMessage `json:"alert,omitempty"`
+	Active   bool            `json:"active,omitempty"`
+	Deleted  bool            `json:"deleted,omitempty"`
+}
+
+// Version returns the fingerprint of the record used to detect changed alerts.
+func (r *Record) Version() string {
+	return r.Sent + "|" + r.Updated
+}
+
+// End returns the time the alert ends, or when it expires if it has no end time.
+func (r *Record) End() time.Time {
+	if !r.Ends.IsZero() {
+		return r.Ends
+	}
+	return r.Expires
+}
+
+// Expired returns true if the record's alert was seen and expired before the specified
+// time. Backfilled alerts may have expired long ago, so the record is kept until it
+// was also seen before the specified time.
+func (r *Record) Expired(before time.Time) bool {
+	return r.Expires.Before(before) && r.Seen.Before(before)
+}
+
+// Seen returns true if the store contains the same version of the alert.
+func Seen(store Store, rec *Record) (_ bool, err error) {
+	var prev *Record
+	if prev, err = store.Get(rec.ID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return prev.Version() == rec.Version(), nil
+}
+
+// OpenStore returns a durable file store if a path is specified, otherwise an
+// in-memory store is returned that does not survive restarts.
+func OpenStore(path string) (Store, error) {
+	if path == "" {
+		return NewMemoryStore(), nil
+	}
+	return OpenFileStore(path)
+}
+
+//===========================================================================
+// Memory Store
+//===========================================================================
+
+// MemoryStore is a thread-safe Store that keeps all records in memory.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+}
+
+var _ Store = &MemoryStore{}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record)}
+}
+
+func (s *MemoryStore) Get(id string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return rec, nil
+}
+
+func (s *MemoryStore) Put(rec *Record) error {
+	if rec.ID == "" {
+		return ErrNoAlertID
+	}
+
+	s.mu.Lock()
+	s.records[rec.ID] = rec
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	delete(s.records, id)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) Prune(before time.Time) (n int, _ error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, rec := range s.records {
+		if rec.Expired(before) {
+			delete(s.records, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) Active() ([]*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*Record, 0)
+	for _, rec := range s.records {
+		if rec.Active {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+//===========================================================================
+// File Store
+//===========================================================================
+
+// FileStore is a durable Store that survives restarts of the publisher. Records are
+// kept in memory and every change is appended to a JSON lines log on disk; the log is
+// compacted when the store is opened and when records are pruned.
+type FileStore struct {
+	MemoryStore
+	path string
+	log  *os.File
+}
+
+var _ Store = &FileStore{}
+
+func OpenFileStore(path string) (store *FileStore, err error) {
+	store = &FileStore{
+		MemoryStore: MemoryStore{records: make(map[string]*Record)},
+		path:        path,
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("could not create store directory: %w", err)
+	}
+
+	if err = store.load(); err != nil {
+		return nil, err
+	}
+
+	if err = store.compact(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *FileStore) Put(rec *Record) (err error) {
+	if err = s.MemoryStore.Put(rec); err != nil {
+		return err
+	}
+	return s.append(rec)
+}
+
+func (s *FileStore) Delete(id string) (err error) {
+	if _, err = s.MemoryStore.Get(id); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if err = s.MemoryStore.Delete(id); err != nil {
+		return err
+	}
+	return s.append(&Record{ID: id, Deleted: true})
+}
+
+func (s *FileStore) Prune(before time.Time) (n int, err error) {
+	if n, err = s.MemoryStore.Prune(before); err != nil || n == 0 {
+		return n, err
+	}
+	return n, s.compact()
+}
+
+func (s *FileStore) Close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log != nil {
+		err = s.log.Close()
+		s.log = nil
+	}
+	return err
+}
+
+// Load the records from the log on disk, replaying puts and deletes in order.
+func (s *FileStore) load() (err error) {
+	var f *os.File
+	if f, err = os.Open(s.path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("could not open store: %w", err)
+	}
+	defer f.Close()
+
+	// Records include the alert data so lines may be longer than a scanner token.
+	reader := bufio.NewReader(f)
+	for {
+		line, rerr := reader.ReadBytes('\n')
+		if rerr != nil && !errors.Is(rerr, io.EOF) {
+			return fmt.Errorf("could not read store: %w", rerr)
+		}
+
+		// A partially written final line is expected after a crash, skip it.
+		rec := &Record{}
+		if len(line) > 0 && json.Unmarshal(line, rec) == nil {
+			if rec.Deleted {
+				delete(s.records, rec.ID)
+			} else {
+				s.records[rec.ID] = rec
+			}
+		}
+
+		if rerr != nil {
+			return nil
+		}
+	}
+}
+
+// Rewrite the log with only the current records, replacing it atomically.
+func (s *FileStore) compact() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log != nil {
+		s.log.Close()
+		s.log = nil
+	}
+
+	tmp := s.path + ".tmp"
+	var f *os.File
+	if f, err = os.Create(tmp); err != nil {
+		return fmt.Errorf("could not compact store: %w", err)
+	}
+
+	encoder := json.NewEncoder(f)
+	for _, rec := range s.records {
+		if err = encoder.Encode(rec); err != nil {
+			f.Close()
+			return fmt.Errorf("could not compact store: %w", err)
+		}
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("could not compact store: %w", err)
+	}
+
+	if err = os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("could not compact store: %w", err)
+	}
+
+	if s.log, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return fmt.Errorf("could not open store: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) append(rec *Record) (err error) {
+	var data []byte
+	if data, err = json.Marshal(rec); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil {
+		return ErrStoreClosed
+	}
+
+	if _, err = s.log.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("could not write to store: %w", err)
+	}
+	return nil
+}
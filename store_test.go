@@ -0,0 +1,110 @@
+package noaalert_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := noaalert.NewMemoryStore()
+	testStore(t, store)
+	require.NoError(t, store.Close())
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts", "store.jsonl")
+	store, err := noaalert.OpenFileStore(path)
+	require.NoError(t, err, "could not open file store")
+	testStore(t, store)
+	require.NoError(t, store.Close())
+
+	// Records should survive reopening the store
+	store, err = noaalert.OpenFileStore(path)
+	require.NoError(t, err, "could not reopen file store")
+	defer store.Close()
+
+	rec, err := store.Get("alert-2")
+	require.NoError(t, err, "record was not persisted")
+	require.Equal(t, "2023-08-03T16:00:00-04:00", rec.Sent)
+
+	_, err = store.Get("alert-1")
+	require.ErrorIs(t, err, noaalert.ErrNotFound, "deleted record was persisted")
+
+	_, err = store.Get("alert-3")
+	require.ErrorIs(t, err, noaalert.ErrNotFound, "pruned record was persisted")
+
+	// Closed stores should not accept writes
+	require.NoError(t, store.Close())
+	require.ErrorIs(t, store.Put(&noaalert.Record{ID: "alert-4"}), noaalert.ErrStoreClosed)
+}
+
+func testStore(t *testing.T, store noaalert.Store) {
+	now := time.Now()
+	records := []*noaalert.Record{
+		{ID: "alert-1", Sent: "2023-08-03T15:19:00-04:00", Expires: now.Add(time.Hour), Seen: now},
+		{ID: "alert-2", Sent: "2023-08-03T15:19:00-04:00", Expires: now.Add(time.Hour), Seen: now},
+		{ID: "alert-3", Sent: "2023-08-03T15:19:00-04:00", Expires: now.Add(-time.Hour), Seen: now.Add(-time.Hour)},
+	}
+
+	for _, rec := range records {
+		seen, err := noaalert.Seen(store, rec)
+		require.NoError(t, err)
+		require.False(t, seen, "new record should not have been seen")
+		require.NoError(t, store.Put(rec))
+
+		seen, err = noaalert.Seen(store, rec)
+		require.NoError(t, err)
+		require.True(t, seen, "record should have been seen after put")
+	}
+
+	// A changed alert should not be seen
+	changed := &noaalert.Record{ID: "alert-2", Sent: "2023-08-03T16:00:00-04:00", Seen: now, Active: true}
+	seen, err := noaalert.Seen(store, changed)
+	require.NoError(t, err)
+	require.False(t, seen, "changed record should not have been seen")
+	require.NoError(t, store.Put(changed))
+
+	require.ErrorIs(t, store.Put(&noaalert.Record{}), noaalert.ErrNoAlertID)
+
+	require.NoError(t, store.Delete("alert-1"))
+	require.NoError(t, store.Delete("alert-1"), "delete should be idempotent")
+	_, err = store.Get("alert-1")
+	require.ErrorIs(t, err, noaalert.ErrNotFound)
+
+	pruned, err := store.Prune(now)
+	require.NoError(t, err)
+	require.Equal(t, 1, pruned, "only the expired record should be pruned")
+
+	active, err := store.Active()
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	require.Equal(t, "alert-2", active[0].ID)
+}
+
+func TestFileStoreLargeRecord(t *testing.T) {
+	// Records larger than the default bufio.Scanner token size should be reloaded
+	alert, err := json.Marshal(&noaalert.Alert{ID: "alert-1", Description: strings.Repeat("x", 128*1024)})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	store, err := noaalert.OpenFileStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Put(&noaalert.Record{ID: "alert-1", Sent: "2023-08-03T15:19:00-04:00", Alert: alert, Seen: time.Now()}))
+	require.NoError(t, store.Put(&noaalert.Record{ID: "alert-2", Sent: "2023-08-03T15:19:00-04:00", Seen: time.Now()}))
+	require.NoError(t, store.Close())
+
+	store, err = noaalert.OpenFileStore(path)
+	require.NoError(t, err, "could not reopen store with a large record")
+	defer store.Close()
+	require.Equal(t, 2, store.Len())
+
+	rec, err := store.Get("alert-1")
+	require.NoError(t, err)
+	require.JSONEq(t, string(alert), string(rec.Alert))
+}
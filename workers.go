@@ -0,0 +1,254 @@
+package noaalert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/rotationalio/go-ensign"
+	"github.com/rs/zerolog/log"
+)
+
+// Number of alert chains tracked for ordering before chains that have ended are pruned.
+const maxChains = 10000
+
+// Handles alerts from a subscription with a pool of workers. If ordered, each alert is
+// assigned to a worker by the key of its chain so that alerts in the same chain are
+// handled serially in the order they were received.
+type workers struct {
+	conf   SubscriberConfig
+	cb     func(*AlertEvent) error
+	ctx    context.Context
+	cancel context.CancelFunc
+	queues []chan *AlertEvent
+	chains map[string]chain
+	wg     sync.WaitGroup
+
+	// If set, alerts are dead-lettered after the callback fails the max attempts.
+	deadLetter  func(event *ensign.Event, reason string, cause error, attempts int) error
+	maxAttempts int
+	backoff     time.Duration
+	mu          sync.Mutex
+	err         error
+}
+
+// The key of the chain an alert belongs to and when the alert ends.
+type chain struct {
+	key string
+	end time.Time
+}
+
+func newWorkers(conf SubscriberConfig, cb func(*AlertEvent) error, cancel context.CancelFunc) *workers {
+	n := conf.Workers
+	if n < 1 {
+		n = 1
+	}
+
+	w := &workers{
+		conf:   conf,
+		cb:     cb,
+		cancel: cancel,
+		chains: make(map[string]chain),
+	}
+
+	// Unordered workers share a single queue.
+	if !conf.Ordered {
+		w.queues = []chan *AlertEvent{make(chan *AlertEvent, n)}
+	} else {
+		w.queues = make([]chan *AlertEvent, n)
+		for i := range w.queues {
+			w.queues[i] = make(chan *AlertEvent, 1)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		w.wg.Add(1)
+		go w.work(w.queues[i%len(w.queues)])
+	}
+	return w
+}
+
+// Run the callback for every alert on the channel until it is closed, then wait for the
+// workers to finish and return the first callback error unless continuing on errors.
+func (w *workers) run(ctx context.Context, alerts <-chan *AlertEvent) error {
+	w.ctx = ctx
+	for alert := range alerts {
+		alert.ctx = ctx
+		w.queue(alert) <- alert
+	}
+
+	for _, queue := range w.queues {
+		close(queue)
+	}
+	w.wg.Wait()
+	return w.Err()
+}
+
+// Returns the queue of the worker that handles the alert.
+func (w *workers) queue(alert *AlertEvent) chan<- *AlertEvent {
+	if len(w.queues) == 1 {
+		return w.queues[0]
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(w.chain(alert)))
+	return w.queues[hash.Sum32()%uint32(len(w.queues))]
+}
+
+// Returns the key of the alert chain, which is the ID of the first alert in the chain
+// that was received. Alerts that could not be parsed are not part of a chain.
+func (w *workers) chain(alert *AlertEvent) string {
+	data, err := alert.Alert()
+	if err != nil || data.ID == "" {
+		return ""
+	}
+
+	key := data.ID
+	if prev, ok := w.chains[data.ID]; ok {
+		key = prev.key
+	} else {
+		for _, id := range alert.Supersedes() {
+			if prev, ok := w.chains[id]; ok {
+				key = prev.key
+				break
+			}
+		}
+	}
+
+	if len(w.chains) >= maxChains {
+		now := time.Now()
+		for id, prev := range w.chains {
+			if !prev.end.IsZero() && prev.end.Before(now) {
+				delete(w.chains, id)
+			}
+		}
+	}
+
+	w.chains[data.ID] = chain{key: key, end: data.End()}
+	return key
+}
+
+func (w *workers) work(queue <-chan *AlertEvent) {
+	defer w.wg.Done()
+	for alert := range queue {
+		// After a failure, drain the queue without handling the remaining alerts.
+		if !w.conf.ContinueOnError && w.Err() != nil {
+			if w.conf.ManualAck {
+				alert.Redeliver()
+			}
+			continue
+		}
+
+		err := w.call(alert)
+		if err != nil && w.deadLetter != nil {
+			err = w.retry(alert, err)
+		}
+
+		if w.conf.ManualAck {
+			alert.settle(err)
+		}
+
+		if err != nil {
+			if !w.conf.ContinueOnError {
+				w.fail(err)
+				continue
+			}
+
+			var id string
+			if data, err := alert.Alert(); err == nil {
+				id = data.ID
+			}
+			log.Warn().Err(err).Str("alert_id", id).Msg("alert callback failed")
+		}
+	}
+}
+
+// Call the callback with the timeout if one is configured. Every call is made with a
+// copy of the alert that has its own context so that a retry does not change the context
+// of an earlier attempt. If the callback does not return before the timeout the context
+// is cancelled and ErrCallbackTimeout is returned once the callback returns, so that the
+// worker does not handle the next alert in the chain while the callback is still running.
+func (w *workers) call(alert *AlertEvent) error {
+	if w.conf.Timeout <= 0 {
+		return w.cb(alert)
+	}
+
+	ctx, cancel := context.WithTimeout(w.ctx, w.conf.Timeout)
+	defer cancel()
+
+	attempt := *alert
+	attempt.ctx = ctx
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.cb(&attempt)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		err := <-done
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w after %s", ErrCallbackTimeout, w.conf.Timeout)
+		}
+
+		// The subscriber is shutting down so return the result of the callback.
+		return err
+	}
+}
+
+// Retry a failed callback until it has been attempted the max number of times, then
+// dead-letter the alert. The backoff between attempts is doubled after every attempt.
+// Returns nil if the callback succeeded or the alert was dead-lettered, otherwise the
+// callback error is returned, e.g. if the subscriber shuts down before the next attempt.
+func (w *workers) retry(alert *AlertEvent, err error) error {
+	backoff := w.backoff
+	for attempts := 1; ; attempts++ {
+		// A callback that nacked the alert has decided how it should be handled.
+		if alert.event == nil || (w.conf.ManualAck && alert.settled()) {
+			return err
+		}
+
+		if attempts >= w.maxAttempts {
+			reason := DeadLetterHandlerFailed
+			if errors.Is(err, ErrCallbackTimeout) {
+				reason = DeadLetterTimeout
+			}
+
+			if dlerr := w.deadLetter(alert.event, reason, err, previousAttempts(alert.Metadata)+attempts); dlerr != nil {
+				log.Error().Err(dlerr).Str("reason", reason).Msg("could not dead-letter alert")
+				return err
+			}
+			return nil
+		}
+
+		if serr := sleep(w.ctx, backoff); serr != nil {
+			return err
+		}
+		backoff *= 2
+
+		if err = w.call(alert); err == nil {
+			return nil
+		}
+	}
+}
+
+// Record the first callback error and stop the subscription.
+func (w *workers) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+		w.cancel()
+	}
+}
+
+func (w *workers) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
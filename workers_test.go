@@ -0,0 +1,47 @@
+package noaalert
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rotationalio/go-ensign"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	failed := errors.New("could not handle alert")
+
+	var attempts int
+	w := &workers{
+		cb: func(*AlertEvent) error {
+			attempts++
+			return failed
+		},
+		ctx:         ctx,
+		cancel:      cancel,
+		maxAttempts: 3,
+		backoff:     time.Hour,
+		deadLetter: func(*ensign.Event, string, error, int) error {
+			t.Error("alert should not be dead-lettered after a shutdown")
+			return nil
+		},
+	}
+
+	// The backoff between attempts stops when the subscriber shuts down
+	done := make(chan error, 1)
+	go func() {
+		done <- w.retry(&AlertEvent{event: &ensign.Event{}}, failed)
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, failed)
+		require.Zero(t, attempts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry did not stop during the backoff")
+	}
+}
@@ -0,0 +1,216 @@
+package noaalert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var _ ZoneResolver = &Weather{}
+
+// Timeout for resolving the zone geometries of a batch of alerts being published.
+const enrichTimeout = 2 * time.Minute
+
+// ZoneGeometry fetches the geometry of an NWS zone, e.g. one of the affectedZones of
+// an alert such as https://api.weather.gov/zones/forecast/MAZ015. Only the path of the
+// zone URL is used so that the request is made to the base URL of the client. Zone
+// geometries rarely change, so they are cached in memory and, if a zone cache directory
+// is configured, on disk; delete the directory to refresh the cached geometries.
+func (s *Weather) ZoneGeometry(ctx context.Context, zoneURL string) (geometry *Geometry, err error) {
+	var path string
+	if path, err = zonePath(zoneURL); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	geometry, ok := s.zones[path]
+	s.mu.Unlock()
+	if ok {
+		return geometry, nil
+	}
+
+	if geometry, err = s.readZone(path); err != nil {
+		if geometry, err = s.fetchZone(ctx, path); err != nil {
+			return nil, err
+		}
+
+		if err = s.writeZone(path, geometry); err != nil {
+			log.Warn().Err(err).Str("zone", path).Msg("could not cache zone geometry")
+		}
+	}
+
+	s.mu.Lock()
+	s.zones[path] = geometry
+	s.mu.Unlock()
+	return geometry, nil
+}
+
+func (s *Weather) fetchZone(ctx context.Context, path string) (_ *Geometry, err error) {
+	var req *http.Request
+	if req, err = s.NewRequest(ctx, http.MethodGet, path, nil, nil); err != nil {
+		return nil, err
+	}
+
+	zone := &struct {
+		Geometry *Geometry `json:"geometry"`
+	}{}
+	if _, err = s.Do(req, zone, true); err != nil {
+		return nil, err
+	}
+
+	if zone.Geometry == nil {
+		return nil, fmt.Errorf("zone %s: %w", path, ErrNoGeometry)
+	}
+	return zone.Geometry, nil
+}
+
+func (s *Weather) readZone(path string) (geometry *Geometry, err error) {
+	if s.zoneCache == "" {
+		return nil, os.ErrNotExist
+	}
+
+	var data []byte
+	if data, err = os.ReadFile(s.zoneCachePath(path)); err != nil {
+		return nil, err
+	}
+
+	geometry = &Geometry{}
+	if err = json.Unmarshal(data, geometry); err != nil {
+		return nil, err
+	}
+	return geometry, nil
+}
+
+// Write the zone geometry to the cache directory, replacing the file atomically.
+func (s *Weather) writeZone(path string, geometry *Geometry) (err error) {
+	if s.zoneCache == "" {
+		return nil
+	}
+
+	var data []byte
+	if data, err = json.Marshal(geometry); err != nil {
+		return err
+	}
+
+	name := s.zoneCachePath(path)
+	if err = os.WriteFile(name+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+func (s *Weather) zoneCachePath(path string) string {
+	name := strings.ReplaceAll(strings.TrimPrefix(path, "/zones/"), "/", "-")
+	return filepath.Join(s.zoneCache, name+".json")
+}
+
+// Returns the path of a zone URL, e.g. /zones/forecast/MAZ015.
+func zonePath(zoneURL string) (_ string, err error) {
+	var u *url.URL
+	if u, err = url.Parse(zoneURL); err != nil {
+		return "", fmt.Errorf("could not parse zone url: %w", err)
+	}
+
+	path := "/" + strings.Trim(u.Path, "/")
+	if !strings.HasPrefix(path, "/zones/") || strings.Count(path, "/") != 3 || strings.Contains(path, "..") {
+		return "", fmt.Errorf("%q is not a zone url", zoneURL)
+	}
+	return path, nil
+}
+
+// MergeGeometries combines the polygons of the geometries into a single MultiPolygon.
+func MergeGeometries(geometries ...*Geometry) (_ *Geometry, err error) {
+	polygons := make([]Polygon, 0, len(geometries))
+	for _, geometry := range geometries {
+		var gpolys []Polygon
+		if gpolys, err = geometry.Polygons(); err != nil {
+			return nil, err
+		}
+		polygons = append(polygons, gpolys...)
+	}
+
+	if len(polygons) == 0 {
+		return nil, ErrNoGeometry
+	}
+
+	merged := &Geometry{Type: "MultiPolygon"}
+	if merged.Coordinates, err = json.Marshal(polygons); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// Add the merged geometry of the affected zones to an alert that has no geometry so
+// that downstream consumers always receive an alert with a shape.
+func (p *Publisher) enrich(ctx context.Context, event *AlertEvent) (err error) {
+	var alert *Alert
+	if alert, err = event.Alert(); err != nil {
+		return err
+	}
+
+	if alert.Geometry != nil || event.EventType() == AlertExpiredType {
+		return nil
+	}
+
+	if len(alert.AffectedZones) == 0 {
+		return ErrNoGeometry
+	}
+
+	geometries := make([]*Geometry, 0, len(alert.AffectedZones))
+	for _, zone := range alert.AffectedZones {
+		var geometry *Geometry
+		if geometry, err = p.api.ZoneGeometry(ctx, zone); err != nil {
+			return err
+		}
+		geometries = append(geometries, geometry)
+	}
+
+	var merged *Geometry
+	if merged, err = MergeGeometries(geometries...); err != nil {
+		return err
+	}
+
+	// Patch the geometry into the original feature to preserve all of its properties.
+	var feature map[string]json.RawMessage
+	if err = json.Unmarshal(event.Data, &feature); err != nil {
+		return err
+	}
+
+	if feature["geometry"], err = json.Marshal(merged); err != nil {
+		return err
+	}
+
+	var data []byte
+	if data, err = json.Marshal(feature); err != nil {
+		return err
+	}
+
+	event.original, event.Data = event.Data, data
+	alert.Geometry = merged
+	return nil
+}
+
+// Enrich the geometry of the alerts, logging alerts that could not be enriched.
+func (p *Publisher) enrichAll(alerts []*AlertEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), enrichTimeout)
+	defer cancel()
+
+	for _, alert := range alerts {
+		if err := p.enrich(ctx, alert); err != nil {
+			if errors.Is(err, ErrNoGeometry) {
+				log.Debug().Err(err).Msg("alert has no zones to resolve geometry from")
+				continue
+			}
+			log.Warn().Err(err).Msg("could not enrich alert with zone geometry")
+		}
+	}
+}
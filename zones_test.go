@@ -0,0 +1,144 @@
+package noaalert_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/noaalert"
+	"github.com/bbengfort/noaalert/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZoneGeometry(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	zone := nws.AddZone("forecast", "MAZ015", "Suffolk", boston)
+
+	cache := t.TempDir()
+	api, err := nws.Weather(noaalert.WithZoneCache(cache))
+	require.NoError(t, err)
+
+	// Zones are fetched by path so the api.weather.gov URLs in alerts use the base URL
+	geometry, err := api.ZoneGeometry(context.Background(), "https://api.weather.gov/zones/forecast/MAZ015")
+	require.NoError(t, err)
+	require.Equal(t, "Polygon", geometry.Type)
+	require.FileExists(t, filepath.Join(cache, "forecast-MAZ015.json"))
+
+	_, err = api.ZoneGeometry(context.Background(), zone)
+	require.NoError(t, err)
+	require.Len(t, nws.Requests(), 1, "zone geometry should be cached in memory")
+
+	// A new client should use the geometries cached on disk
+	nws.Reset()
+	api, err = nws.Weather(noaalert.WithZoneCache(cache))
+	require.NoError(t, err)
+	_, err = api.ZoneGeometry(context.Background(), zone)
+	require.NoError(t, err)
+	require.Empty(t, nws.Requests(), "zone geometry should be cached on disk")
+
+	require.NoError(t, os.RemoveAll(cache))
+	api, err = nws.Weather()
+	require.NoError(t, err)
+	api.SetRetryPolicy(noaalert.NoRetries)
+
+	target := &noaalert.APIError{}
+	_, err = api.ZoneGeometry(context.Background(), zone)
+	require.ErrorAs(t, err, &target)
+	require.True(t, target.NotFound())
+
+	_, err = api.ZoneGeometry(context.Background(), "https://api.weather.gov/alerts/active")
+	require.Error(t, err, "only zone urls should be resolved")
+}
+
+func TestZoneFreshness(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	zone := nws.AddZone("forecast", "MAZ015", "Suffolk", boston)
+	nws.Issue(nil)
+
+	api, err := nws.Weather()
+	require.NoError(t, err)
+
+	_, err = api.Alerts(context.Background(), nil)
+	require.NoError(t, err)
+	expires := api.Expires()
+	require.WithinDuration(t, time.Now().Add(mock.DefaultMaxAge), expires, 2*time.Second)
+
+	// Zone responses do not have cache headers and should not change the freshness
+	_, err = api.ZoneGeometry(context.Background(), zone)
+	require.NoError(t, err)
+	require.Equal(t, expires, api.Expires())
+
+	// A not modified response is still fresh for the max age
+	_, err = api.Alerts(context.Background(), nil)
+	require.ErrorIs(t, err, noaalert.ErrNotModified)
+	require.False(t, api.Expires().Before(expires))
+}
+
+func TestMergeGeometries(t *testing.T) {
+	merged, err := noaalert.MergeGeometries(boston, boston)
+	require.NoError(t, err)
+	require.Equal(t, "MultiPolygon", merged.Type)
+
+	polygons, err := merged.Polygons()
+	require.NoError(t, err)
+	require.Len(t, polygons, 2)
+
+	_, err = noaalert.MergeGeometries()
+	require.ErrorIs(t, err, noaalert.ErrNoGeometry)
+}
+
+func TestEnrichGeometry(t *testing.T) {
+	nws := mock.New()
+	defer nws.Close()
+	zone := nws.AddZone("forecast", "MAZ015", "Suffolk", boston)
+	issued := nws.Issue(&noaalert.Alert{Event: "Flood Warning", AffectedZones: []string{zone}})
+
+	path := filepath.Join(t.TempDir(), "alerts.jsonl")
+	conf, err := noaalert.Config{
+		Topic:          "noaa-alerts",
+		Interval:       5 * time.Minute,
+		StorePath:      path,
+		AckTimeout:     time.Second,
+		PublishBackoff: time.Millisecond,
+		EnrichGeometry: true,
+		Weather:        noaalert.WeatherConfig{UserAgent: testUserAgent, BaseURL: nws.URL().String()},
+	}.Mark()
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	pub, err := noaalert.New(conf, noaalert.NewWriterSink("stdout", out))
+	require.NoError(t, err)
+
+	stats, err := pub.Backfill(context.Background(), time.Now().Add(-time.Hour), time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.Acked)
+	require.NoError(t, pub.Shutdown())
+
+	// The published alert includes the merged geometry of its zones
+	event := &struct {
+		Data *noaalert.Alert `json:"data"`
+	}{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), event))
+	require.Equal(t, issued.ID, event.Data.ID)
+	require.NotNil(t, event.Data.Geometry)
+	require.Equal(t, "MultiPolygon", event.Data.Geometry.Type)
+
+	// The store keeps the alert as it was received without the enriched geometry
+	store, err := noaalert.OpenFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	rec, err := store.Get(issued.ID)
+	require.NoError(t, err)
+
+	stored := &noaalert.Alert{}
+	require.NoError(t, json.Unmarshal(rec.Alert, stored))
+	require.Equal(t, issued.ID, stored.ID)
+	require.Nil(t, stored.Geometry)
+}